@@ -0,0 +1,108 @@
+package canonical
+
+import (
+	nurl "net/url"
+	"sort"
+	"strings"
+)
+
+// trackingParams are query parameters added for analytics which don't change the page content.
+var trackingParams = map[string]bool{
+	"fbclid":   true,
+	"gclid":    true,
+	"dclid":    true,
+	"msclkid":  true,
+	"yclid":    true,
+	"igshid":   true,
+	"mc_cid":   true,
+	"mc_eid":   true,
+	"_hsenc":   true,
+	"_hsmi":    true,
+	"mkt_tok":  true,
+	"ref_src":  true,
+	"ref_url":  true,
+	"cmpid":    true,
+	"sr_share": true,
+}
+
+// trackingPrefixes are prefixes of families of tracking parameters (utm_source, utm_medium, ...).
+var trackingPrefixes = []string{"utm_", "pk_", "mtm_", "__twitter", "oly_"}
+
+func isTracking(param string) bool {
+	param = strings.ToLower(param)
+	if trackingParams[param] {
+		return true
+	}
+	for _, p := range trackingPrefixes {
+		if strings.HasPrefix(param, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean removes tracking parameters and the fragment from url, and lower cases the scheme and host.
+// The result is still the address of the same page, so it is suitable for writing to a note.
+// Unparseable URLs are returned unchanged.
+func Clean(url string) string {
+	u, err := nurl.Parse(strings.TrimSpace(url))
+	if err != nil || u.Host == "" {
+		return url
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	q := u.Query()
+	for param := range q {
+		if isTracking(param) {
+			q.Del(param)
+		}
+	}
+	u.RawQuery = q.Encode() // also sorts the parameters
+	return u.String()
+}
+
+// Key reduces url to a comparison key: two URLs with the same key are taken to be the same article.
+// On top of Clean the scheme, a leading www. and a trailing slash are ignored.
+func Key(url string) string {
+	u, err := nurl.Parse(Clean(url))
+	if err != nil || u.Host == "" {
+		return url
+	}
+	host := strings.TrimPrefix(u.Host, "www.")
+	path := strings.TrimRight(u.EscapedPath(), "/")
+	key := host + path
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		sort.Strings(params)
+		key += "?" + strings.Join(params, "&")
+	}
+	return key
+}
+
+// Domain returns the lower case host of url without a leading www., or "" if it can't be parsed.
+func Domain(url string) string {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// SameSite reports whether a and b are on the same host, ignoring a leading www.
+func SameSite(a string, b string) bool {
+	ua, err := nurl.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := nurl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.TrimPrefix(strings.ToLower(ua.Hostname()), "www.") == strings.TrimPrefix(strings.ToLower(ub.Hostname()), "www.")
+}
@@ -0,0 +1,46 @@
+package canonical
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCanonical(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "canonical suite")
+}
+
+var _ = Describe("CanonicalTest", func() {
+
+	It("Should strip tracking parameters and fragments", func() {
+		Expect(Clean("https://Example.COM/a?utm_source=x&utm_medium=y&id=3&fbclid=abc#top")).To(Equal("https://example.com/a?id=3"))
+		Expect(Clean("https://example.com/a?utm_campaign=z")).To(Equal("https://example.com/a"))
+		Expect(Clean("http://example.com:80/a")).To(Equal("http://example.com/a"))
+		Expect(Clean("https://github.com/a/b/blob/main/go.mod?ref=v1.2")).To(Equal("https://github.com/a/b/blob/main/go.mod?ref=v1.2"), "ref changes the content")
+	})
+
+	It("Should leave unparseable URLs alone", func() {
+		Expect(Clean("not a url")).To(Equal("not a url"))
+	})
+
+	It("Should give variants of the same article the same key", func() {
+		key := Key("https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos")
+		Expect(Key("http://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos")).To(Equal(key))
+		Expect(Key("https://www.hbr.org/2024/09/ai-can-mostly-outperform-human-ceos/")).To(Equal(key))
+		Expect(Key("https://HBR.org/2024/09/ai-can-mostly-outperform-human-ceos?utm_source=pocket_saves")).To(Equal(key))
+		Expect(Key("https://hbr.org/2024/09/something-else")).NotTo(Equal(key))
+	})
+
+	It("Should ignore query parameter order in keys", func() {
+		Expect(Key("https://example.com/a?b=2&a=1")).To(Equal(Key("https://example.com/a?a=1&b=2")))
+		Expect(Key("https://example.com/a?a=1")).NotTo(Equal(Key("https://example.com/a?a=2")))
+	})
+
+	It("Should compare sites", func() {
+		Expect(SameSite("https://www.hbr.org/a", "http://hbr.org/b")).To(BeTrue())
+		Expect(SameSite("https://hbr.org/a", "https://medium.com/a")).To(BeFalse())
+		Expect(Domain("https://WWW.HBR.org:443/a")).To(Equal("hbr.org"))
+	})
+})
@@ -0,0 +1,145 @@
+package canvas
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+
+	"github.com/fergalsomers/pocket-obsidian/moc"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// Ways of grouping the clippings on a canvas.
+const (
+	GroupTag    = "tag"
+	GroupDomain = "domain"
+)
+
+// Build returns a canvas of the notes of the vault at root grouped by tag or domain, only those unread if unread is set.
+func Build(root string, notes []vault.Note, group string, unread bool) (*Canvas, error) {
+	kind := ""
+	switch group {
+	case GroupTag:
+		kind = moc.KindTag
+	case GroupDomain:
+		kind = moc.KindDomain
+	default:
+		return nil, fmt.Errorf("unknown canvas grouping %q, expected %s or %s", group, GroupTag, GroupDomain)
+	}
+	if unread {
+		var kept []vault.Note
+		for _, n := range notes {
+			if !n.Clipping.Metadata.Read {
+				kept = append(kept, n)
+			}
+		}
+		notes = kept
+	}
+	var groups []*moc.MOC
+	for _, m := range moc.Build(notes) {
+		if m.Kind == kind {
+			groups = append(groups, m)
+		}
+	}
+	return New(root, groups), nil
+}
+
+// Layout of the grid, in canvas pixels.
+const (
+	cardWidth   = 400
+	cardHeight  = 240
+	gap         = 40
+	cardColumns = 4 // cards per row of a group
+	groupWidth  = cardColumns*cardWidth + (cardColumns+1)*gap
+	groupsInRow = 3
+)
+
+// Node is a node of a JSON Canvas (https://jsoncanvas.org), a group or a card showing a note.
+type Node struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	File   string `json:"file,omitempty"`
+	Label  string `json:"label,omitempty"`
+}
+
+// Edge connects two nodes, canvases generated here have none.
+type Edge struct {
+	ID       string `json:"id"`
+	FromNode string `json:"fromNode"`
+	ToNode   string `json:"toNode"`
+}
+
+// Canvas is an Obsidian .canvas file.
+type Canvas struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// New lays out each map of content as a labelled group of cards, one per note of the vault at root,
+// with the groups on a grid in the order given.
+func New(root string, groups []*moc.MOC) *Canvas {
+	c := &Canvas{Nodes: []Node{}, Edges: []Edge{}}
+	y, rowHeight := 0, 0
+	for i, g := range groups {
+		if i > 0 && i%groupsInRow == 0 {
+			y += rowHeight + gap*2 // room for the label above the group
+			rowHeight = 0
+		}
+		x := (i % groupsInRow) * (groupWidth + gap)
+		rows := (len(g.Notes) + cardColumns - 1) / cardColumns
+		columns := min(len(g.Notes), cardColumns)
+		height := rows*cardHeight + (rows+1)*gap
+		rowHeight = max(rowHeight, height)
+
+		c.Nodes = append(c.Nodes, Node{
+			ID:     id(g.Kind, g.Name),
+			Type:   "group",
+			X:      x,
+			Y:      y,
+			Width:  columns*cardWidth + (columns+1)*gap,
+			Height: height,
+			Label:  g.Name,
+		})
+		for j, n := range g.Notes {
+			file := n.Path
+			if rel, err := filepath.Rel(root, n.Path); err == nil {
+				file = rel
+			}
+			file = filepath.ToSlash(file)
+			c.Nodes = append(c.Nodes, Node{
+				ID:     id(g.Kind, g.Name, file),
+				Type:   "file",
+				X:      x + gap + (j%cardColumns)*(cardWidth+gap),
+				Y:      y + gap + (j/cardColumns)*(cardHeight+gap),
+				Width:  cardWidth,
+				Height: cardHeight,
+				File:   file,
+			})
+		}
+	}
+	return c
+}
+
+// JSON returns the canvas as Obsidian writes it.
+func (c *Canvas) JSON() ([]byte, error) {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("error writing canvas: %w", err)
+	}
+	return b, nil
+}
+
+// id returns a stable node id, so regenerating a canvas doesn't change the ids of its nodes.
+func id(parts ...string) string {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,79 @@
+package canvas
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"github.com/fergalsomers/pocket-obsidian/vault/vaulttest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCanvas(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "canvas suite")
+}
+
+var _ = Describe("CanvasTest", func() {
+
+	notes := []vault.Note{
+		vaulttest.Note("AI CEOs.md", page.ClippingMetadata{Title: "AI CEOs", Source: "https://hbr.org/ai-ceos", Created: "2025-05-22", Tags: []string{"ai"}, Read: true}),
+		vaulttest.Note("Tech/Istio.md", page.ClippingMetadata{Title: "Istio", Source: "https://aws.amazon.com/istio", Created: "2025-05-16", Tags: []string{"ai", "k8s"}}),
+		vaulttest.Note("Aperture.md", page.ClippingMetadata{Title: "Aperture", Source: "https://hbr.org/aperture", Created: "2023-09-20"}),
+	}
+	for i := range 4 {
+		notes = append(notes, vaulttest.Note(filepath.Join("k8s", string(rune('a'+i))+".md"), page.ClippingMetadata{Source: "https://k8s.io/", Created: "2024-01-01", Tags: []string{"k8s"}}))
+	}
+
+	It("Should group the notes by tag on a grid", func() {
+		c, err := Build(vaulttest.Root, notes, GroupTag, false)
+		Expect(err).To(BeNil())
+		Expect(c.Nodes).To(HaveLen(2 + 2 + 5))
+		ai, k8s := c.Nodes[0], c.Nodes[3]
+		Expect([]any{ai.Type, ai.Label, ai.X, ai.Y}).To(Equal([]any{"group", "ai", 0, 0}))
+		Expect([]any{c.Nodes[1].Type, c.Nodes[1].File, c.Nodes[1].X, c.Nodes[1].Y}).To(Equal([]any{"file", "AI CEOs.md", gap, gap}))
+		Expect(c.Nodes[2].File).To(Equal("Tech/Istio.md"))
+		Expect(c.Nodes[2].X).To(Equal(gap + cardWidth + gap))
+		Expect(k8s.Label).To(Equal("k8s"))
+		Expect(k8s.X).To(Equal(groupWidth + gap))
+		Expect(k8s.Height).To(Equal(2*cardHeight+3*gap), "5 notes wrap onto a second row")
+		Expect(c.Nodes[8].Y).To(Equal(gap + cardHeight + gap))
+
+		again, _ := Build(vaulttest.Root, notes, GroupTag, false)
+		Expect(again.Nodes[1].ID).To(Equal(c.Nodes[1].ID), "ids are stable")
+		Expect(c.Nodes[1].ID).NotTo(Equal(c.Nodes[2].ID))
+	})
+
+	It("Should only show unread notes grouped by domain", func() {
+		c, err := Build(vaulttest.Root, notes, GroupDomain, true)
+		Expect(err).To(BeNil())
+		labels := []string{}
+		for _, n := range c.Nodes {
+			if n.Type == "group" {
+				labels = append(labels, n.Label)
+			}
+		}
+		Expect(labels).To(Equal([]string{"aws.amazon.com", "hbr.org", "k8s.io"}))
+		Expect(c.Nodes[3].File).To(Equal("Aperture.md"), "AI CEOs has been read")
+
+		_, err = Build(vaulttest.Root, notes, "month", false)
+		Expect(err).To(MatchError(ContainSubstring("unknown canvas grouping")))
+	})
+
+	It("Should write JSON Canvas", func() {
+		c, _ := Build(vaulttest.Root, notes[:1], GroupTag, false)
+		b, err := c.JSON()
+		Expect(err).To(BeNil())
+		var canvas map[string][]map[string]any
+		Expect(json.Unmarshal(b, &canvas)).To(Succeed())
+		Expect(canvas["edges"]).To(BeEmpty())
+		Expect(canvas["nodes"][1]).To(HaveKeyWithValue("type", "file"))
+		Expect(canvas["nodes"][1]).To(HaveKeyWithValue("file", "AI CEOs.md"))
+		Expect(canvas["nodes"][1]).To(HaveKeyWithValue("width", BeNumerically("==", cardWidth)))
+		Expect(canvas["nodes"][0]).NotTo(HaveKey("file"))
+	})
+})
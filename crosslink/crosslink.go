@@ -0,0 +1,124 @@
+package crosslink
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// Index is the clippings of a vault by the canonical.Key of their source, to resolve links to them.
+type Index map[string]vault.Note
+
+// NewIndex indexes the notes by source.
+func NewIndex(notes []vault.Note) Index {
+	x := Index{}
+	for _, n := range notes {
+		x[canonical.Key(n.Clipping.Metadata.Source)] = n
+	}
+	return x
+}
+
+// markdownLink matches an inline Markdown link to a web page: an optional ! (for images), the text (with at most
+// one level of nested brackets), the URL (optionally in <>) and an optional title.
+var markdownLink = regexp.MustCompile(`(!?)\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\(<?(https?://[^\s)>]+)>?(?:\s+"[^"]*")?\)`)
+
+// inlineCode matches an inline code span, delimited by one backtick or by two (to hold a backtick).
+var inlineCode = regexp.MustCompile("``.*?``|`[^`\n]*`")
+
+// Rewrite returns the markdown of the note at from with its links to clipped articles replaced by links to their notes,
+// and the number replaced. Images, links to the note itself, code blocks and inline code are left alone.
+func (x Index) Rewrite(markdown []byte, from string, l vault.Links) ([]byte, int) {
+	rewritten := 0
+	fenced := false
+	lines := bytes.SplitAfter(markdown, []byte("\n"))
+	for i, line := range lines {
+		if trimmed := bytes.TrimSpace(line); bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+		lines[i] = outsideCode(line, func(text []byte) []byte {
+			return markdownLink.ReplaceAllFunc(text, func(link []byte) []byte {
+				m := markdownLink.FindSubmatch(link)
+				text := string(m[2])
+				if len(m[1]) > 0 || strings.Contains(text, "](") {
+					return link // an image, or a linked image
+				}
+				n, ok := x[canonical.Key(string(m[3]))]
+				if !ok || n.Path == from {
+					return link
+				}
+				rewritten++
+				return []byte(l.Link(from, n.Path, text))
+			})
+		})
+	}
+	return bytes.Join(lines, nil), rewritten
+}
+
+// outsideCode returns line with f applied to the text between its inline code spans.
+func outsideCode(line []byte, f func(text []byte) []byte) []byte {
+	out := []byte{}
+	last := 0
+	for _, span := range inlineCode.FindAllIndex(line, -1) {
+		out = append(out, f(line[last:span[0]])...)
+		out = append(out, line[span[0]:span[1]]...)
+		last = span[1]
+	}
+	return append(out, f(line[last:])...)
+}
+
+// RewriteNote rewrites the links to clipped articles in the body of the note at path, leaving its frontmatter as is.
+// The note is replaced once the rewritten note is written, so it is never left partly written.
+// Returns the number of links rewritten.
+func (x Index) RewriteNote(path string, l vault.Links) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	parts := bytes.SplitN(b, page.ByteDelimiter, 3)
+	body, start := b, 0
+	if len(parts) == 3 && len(bytes.TrimSpace(parts[0])) == 0 {
+		start = len(parts[0]) + len(parts[1]) + 2*len(page.ByteDelimiter)
+		body = b[start:]
+	}
+	rewritten, n := x.Rewrite(body, path, l)
+	if n == 0 {
+		return 0, nil
+	}
+	out := append(append([]byte{}, b[:start]...), rewritten...)
+	return n, replace(path, out)
+}
+
+// replace writes content to a temporary file alongside path, then renames it over path keeping its permissions.
+func replace(path string, content []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := os.Chmod(f.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,76 @@
+package crosslink
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"github.com/fergalsomers/pocket-obsidian/vault/vaulttest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCrosslink(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "crosslink suite")
+}
+
+// clipped returns a clipping of the source.
+func clipped(path string, source string) vault.Note {
+	return vaulttest.Note(path, page.ClippingMetadata{Source: source})
+}
+
+var _ = Describe("CrosslinkTest", func() {
+
+	x := NewIndex([]vault.Note{
+		clipped("AI CEOs.md", "https://hbr.org/2024/09/ai-ceos"),
+		clipped("Tech/Istio.md", "https://aws.amazon.com/istio"),
+	})
+	l := vault.Links{Root: vaulttest.Root}
+
+	It("Should link to clipped articles", func() {
+		markdown := "See [the CEO study](https://www.hbr.org/2024/09/ai-ceos/?utm_source=x) and [Istio | traffic](<https://aws.amazon.com/istio> \"Istio\").\n" +
+			"Not [clipped](https://example.com/) or ![an image](https://aws.amazon.com/istio).\n" +
+			"[![logo](https://hbr.org/logo.png)](https://hbr.org/2024/09/ai-ceos)\n" +
+			"```\n[in code](https://aws.amazon.com/istio)\n```\n" +
+			"Write `[inline](https://aws.amazon.com/istio)` or ``a `[tick`](https://hbr.org/2024/09/ai-ceos)`` but [Istio](https://aws.amazon.com/istio).\n"
+		rewritten, n := x.Rewrite([]byte(markdown), filepath.Join(vaulttest.Root, "Reading.md"), l)
+		Expect(n).To(Equal(3))
+		Expect(string(rewritten)).To(Equal("See [[AI CEOs|the CEO study]] and [[Tech/Istio|Istio - traffic]].\n" +
+			"Not [clipped](https://example.com/) or ![an image](https://aws.amazon.com/istio).\n" +
+			"[![logo](https://hbr.org/logo.png)](https://hbr.org/2024/09/ai-ceos)\n" +
+			"```\n[in code](https://aws.amazon.com/istio)\n```\n" +
+			"Write `[inline](https://aws.amazon.com/istio)` or ``a `[tick`](https://hbr.org/2024/09/ai-ceos)`` but [[Tech/Istio|Istio]].\n"))
+
+		_, n = x.Rewrite([]byte("[itself](https://aws.amazon.com/istio)"), filepath.Join(vaulttest.Root, "Tech", "Istio.md"), l)
+		Expect(n).To(Equal(0))
+
+		rewritten, n = x.Rewrite([]byte("[Istio](https://aws.amazon.com/istio)"), filepath.Join(vaulttest.Root, "Daily", "x.md"), vault.Links{Root: vaulttest.Root, Format: vault.LinkRelative, Markdown: true})
+		Expect(n).To(Equal(1))
+		Expect(string(rewritten)).To(Equal("[Istio](../Tech/Istio.md)"))
+	})
+
+	It("Should rewrite the body of a note leaving the frontmatter", func() {
+		dir := GinkgoT().TempDir()
+		path := filepath.Join(dir, "Note.md")
+		content := "---\nsource: https://aws.amazon.com/istio\n---\n[Istio](https://aws.amazon.com/istio)\n"
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		x := NewIndex([]vault.Note{{Path: filepath.Join(dir, "Istio.md"), Clipping: &page.Clipping{Metadata: page.ClippingMetadata{Source: "https://aws.amazon.com/istio"}}}})
+		n, err := x.RewriteNote(path, vault.Links{Root: dir})
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(1))
+		b, _ := os.ReadFile(path)
+		Expect(string(b)).To(Equal("---\nsource: https://aws.amazon.com/istio\n---\n[[Istio]]\n"))
+		info, _ := os.Stat(path)
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		entries, _ := os.ReadDir(dir)
+		Expect(entries).To(HaveLen(1), "no temporary file is left")
+
+		n, err = x.RewriteNote(path, vault.Links{Root: dir})
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(0))
+	})
+})
@@ -0,0 +1,76 @@
+package csv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+	"github.com/fergalsomers/pocket-obsidian/page"
+)
+
+// annotation is an article in the annotations/part_*.json files of a Pocket export.
+type annotation struct {
+	URL        string           `json:"url"`
+	Title      string           `json:"title"`
+	Highlights []page.Highlight `json:"highlights"`
+}
+
+// ReadAnnotations reads the highlights from the annotations folder of a Pocket export ZIP or extracted directory.
+// The highlights are keyed by canonical.Key of the article URL. Any other path has no annotations.
+func ReadAnnotations(exportPath string) (map[string][]page.Highlight, error) {
+	fsys, closer, err := OpenArchive(exportPath)
+	if err != nil {
+		return nil, err
+	}
+	if fsys == nil {
+		return map[string][]page.Highlight{}, nil
+	}
+	defer closer.Close()
+	return readAnnotations(fsys)
+}
+
+func readAnnotations(fsys fs.FS) (map[string][]page.Highlight, error) {
+	names := []string{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && path.Ext(p) == ".json" && path.Base(path.Dir(p)) == "annotations" {
+			names = append(names, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %w", err)
+	}
+	sort.Strings(names)
+
+	highlights := map[string][]page.Highlight{}
+	for _, name := range names {
+		file, err := fsys.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		b, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		var annotations []annotation
+		if err := json.Unmarshal(b, &annotations); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		for _, a := range annotations {
+			key := canonical.Key(a.URL)
+			highlights[key] = append(highlights[key], a.Highlights...)
+		}
+	}
+	for _, h := range highlights {
+		sort.SliceStable(h, func(i, j int) bool { return h[i].CreatedAt < h[j].CreatedAt })
+	}
+	return highlights, nil
+}
@@ -1,9 +1,15 @@
 package csv
 
 import (
+	"archive/zip"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -27,4 +33,105 @@ var _ = Describe("CSVTest", Ordered, func() {
 			Expect(len(records)).To(Equal(6), "Expected 5 records, got %d", len(records))
 		})
 	})
+	Context("URLTest", func() {
+
+		It("should read newline separated URLs", func() {
+			input := "https://example.com/a\n\n# a comment\n  http://example.org/b  \n"
+			urls, err := ReadURLs(strings.NewReader(input))
+			Expect(err).To(BeNil(), "Failed to read URLs")
+			Expect(urls).To(Equal([]string{"https://example.com/a", "http://example.org/b"}))
+		})
+
+		It("should reject lines which are not URLs", func() {
+			_, err := ReadURLs(strings.NewReader("https://example.com/a\nnot-a-url\n"))
+			Expect(err).NotTo(BeNil())
+		})
+	})
+	Context("ExportTest", func() {
+
+		expectExport := func(records [][]string, parts []Part) {
+			Expect(records).To(HaveLen(3))
+			Expect(records[0][0]).To(Equal("Introduction - Updatecli"))
+			Expect(records[2][0]).To(Equal("Aperture in Photography"))
+			Expect(parts).To(HaveLen(2))
+			Expect(parts[0].Records).To(Equal(2))
+			Expect(parts[1].Records).To(Equal(1))
+		}
+
+		It("should read the parts of an extracted export directory", func() {
+			records, parts, err := ReadExport(filepath.Join("testdata", "export"))
+			Expect(err).To(BeNil())
+			expectExport(records, parts)
+			Expect(parts[0].Name).To(Equal("part_000000.csv"))
+		})
+
+		It("should read the parts of an export ZIP", func() {
+			zipFile := filepath.Join(GinkgoT().TempDir(), "pocket.zip")
+			f, err := os.Create(zipFile)
+			Expect(err).To(BeNil())
+			w := zip.NewWriter(f)
+			// written out of order, they are read in order
+			for _, name := range []string{"part_000001.csv", "part_000000.csv"} {
+				in, err := os.Open(filepath.Join("testdata", "export", name))
+				Expect(err).To(BeNil())
+				out, err := w.Create(name)
+				Expect(err).To(BeNil())
+				_, err = io.Copy(out, in)
+				Expect(err).To(BeNil())
+				in.Close()
+			}
+			Expect(w.Close()).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			records, parts, err := ReadExport(zipFile)
+			Expect(err).To(BeNil())
+			expectExport(records, parts)
+		})
+
+		It("should read a single CSV without its header", func() {
+			records, parts, err := ReadExport(filepath.Join("testdata", "test.csv"))
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(5))
+			Expect(parts).To(Equal([]Part{{Name: "test.csv", Records: 5}}))
+		})
+
+		It("should reject a part with the wrong header", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "part_000000.csv"), []byte("url,title\nhttps://example.com,Example\n"), 0644)).To(Succeed())
+			_, _, err := ReadExport(dir)
+			Expect(err).NotTo(BeNil())
+		})
+	})
+	Context("AnnotationsTest", func() {
+
+		It("should read highlights keyed by URL", func() {
+			highlights, err := ReadAnnotations(filepath.Join("testdata", "export"))
+			Expect(err).To(BeNil())
+			h := highlights[canonical.Key("https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos?utm_source=pocket")]
+			Expect(h).To(HaveLen(2))
+			// in the order they were made
+			Expect(h[0].Quote).To(Equal("but it was fired faster"))
+			Expect(h[1].CreatedAt).To(Equal(int64(1747900913)))
+		})
+
+		It("should have no highlights for a CSV file", func() {
+			highlights, err := ReadAnnotations(filepath.Join("testdata", "test.csv"))
+			Expect(err).To(BeNil())
+			Expect(highlights).To(BeEmpty())
+		})
+	})
+	Context("InstapaperTest", func() {
+
+		It("should read the rows of an Instapaper export", func() {
+			rows, err := ReadInstapaper(filepath.Join("testdata", "instapaper.csv"))
+			Expect(err).To(BeNil())
+			Expect(rows).To(HaveLen(3))
+			Expect(rows[0]).To(Equal([]string{"https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos", "AI Can (Mostly) Outperform Human CEOs", "the AI outperformed human participants on most metrics", "Unread", "1747900713"}))
+		})
+
+		It("should reject a Pocket export", func() {
+			_, err := ReadInstapaper(filepath.Join("testdata", "test.csv"))
+			Expect(err).NotTo(BeNil())
+		})
+	})
 })
@@ -0,0 +1,147 @@
+package csv
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PocketHeader is the header of every CSV in a Pocket export.
+var PocketHeader = []string{"title", "url", "time_added", "tags", "status"}
+
+// partName matches the CSV parts of a Pocket export ZIP: part_000000.csv, part_000001.csv, ...
+var partName = regexp.MustCompile(`^part_\d+\.csv$`)
+
+// Part is a CSV file read from an export and the number of records it contained.
+type Part struct {
+	Name    string
+	Records int
+}
+
+// ReadExport reads the records of a Pocket export, without headers.
+// path is either the export ZIP, the directory it was extracted to, or a single CSV file.
+// The parts of a ZIP or directory are read in order and each must have the Pocket header.
+func ReadExport(path string) ([][]string, []Part, error) {
+	fsys, closer, err := OpenArchive(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fsys != nil {
+		defer closer.Close()
+		return readParts(fsys)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+	records, err := readPart(file, filepath.Base(path))
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, []Part{{Name: filepath.Base(path), Records: len(records)}}, nil
+}
+
+// OpenArchive opens a ZIP file or directory as a file system, which must be closed after use.
+// For any other file the file system is nil.
+func OpenArchive(path string) (fs.FS, io.Closer, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open export: %w", err)
+	}
+	switch {
+	case info.IsDir():
+		return os.DirFS(path), io.NopCloser(nil), nil
+	case strings.EqualFold(filepath.Ext(path), ".zip"):
+		z, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open export ZIP: %w", err)
+		}
+		return z, z, nil
+	}
+	return nil, nil, nil
+}
+
+// readParts reads every part_*.csv in fsys, in name order.
+func readParts(fsys fs.FS) ([][]string, []Part, error) {
+	names := []string{}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && partName.MatchString(d.Name()) {
+			names = append(names, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list export: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("export contains no part_*.csv files")
+	}
+	sort.Slice(names, func(i, j int) bool { return path.Base(names[i]) < path.Base(names[j]) })
+
+	records := [][]string{}
+	parts := make([]Part, 0, len(names))
+	for _, name := range names {
+		file, err := fsys.Open(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		partRecords, err := readPart(file, name)
+		file.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, partRecords...)
+		parts = append(parts, Part{Name: name, Records: len(partRecords)})
+	}
+	return records, parts, nil
+}
+
+// readPart reads a single CSV, checking and removing the Pocket header.
+func readPart(r io.Reader, name string) ([][]string, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file %s: %w", name, err)
+	}
+	if len(records) == 0 {
+		return records, nil
+	}
+	if !HasHeader(records[0], PocketHeader) {
+		return nil, fmt.Errorf("%s has header %v, expected %v", name, records[0], PocketHeader)
+	}
+	return records[1:], nil
+}
+
+// ReadHeader reads the first row of a CSV.
+func ReadHeader(r io.Reader) ([]string, error) {
+	header, err := csv.NewReader(r).Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	return header, nil
+}
+
+// HasHeader reports whether header starts with the expected columns, ignoring spaces and a byte order mark.
+func HasHeader(header []string, expected []string) bool {
+	if len(header) < len(expected) {
+		return false
+	}
+	for i, h := range expected {
+		if strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")) != h {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package csv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// InstapaperHeader is the header of an Instapaper export CSV.
+var InstapaperHeader = []string{"URL", "Title", "Selection", "Folder", "Timestamp"}
+
+// ReadInstapaper reads the rows (URL,Title,Selection,Folder,Timestamp) of an Instapaper export CSV, without its header.
+func ReadInstapaper(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+	if len(rows) == 0 || !HasHeader(rows[0], InstapaperHeader) {
+		return nil, fmt.Errorf("%s is not an Instapaper export, expected header %v", path, InstapaperHeader)
+	}
+	return rows[1:], nil
+}
@@ -0,0 +1,33 @@
+package csv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IsURL reports whether s looks like a http(s) URL rather than a file path.
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// ReadURLs reads newline separated URLs, ignoring blank lines and lines starting with #
+func ReadURLs(r io.Reader) ([]string, error) {
+	urls := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !IsURL(line) {
+			return nil, fmt.Errorf("not a URL: %s", line)
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URLs: %w", err)
+	}
+	return urls, nil
+}
@@ -0,0 +1,238 @@
+package daily
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// DefaultFormat is the date format of daily notes, as in Obsidian.
+const DefaultFormat = "YYYY-MM-DD"
+
+// Heading is the heading of the section of a daily note listing the clippings saved that day.
+const Heading = "## Saved"
+
+// Day is the clippings saved on a day, the day they were added to Pocket.
+type Day struct {
+	Date  time.Time
+	Notes []vault.Note
+}
+
+// Build returns the days the notes were saved on, oldest first, with their notes sorted by title.
+// Notes without a created date are left out.
+func Build(notes []vault.Note) []*Day {
+	byDate := map[string]*Day{}
+	for _, n := range notes {
+		created := n.Clipping.Metadata.Created
+		if len(created) < len(time.DateOnly) {
+			continue
+		}
+		date, err := time.Parse(time.DateOnly, created[:len(time.DateOnly)])
+		if err != nil {
+			continue
+		}
+		d, ok := byDate[date.Format(time.DateOnly)]
+		if !ok {
+			d = &Day{Date: date}
+			byDate[date.Format(time.DateOnly)] = d
+		}
+		d.Notes = append(d.Notes, n)
+	}
+	days := make([]*Day, 0, len(byDate))
+	for _, d := range byDate {
+		sort.SliceStable(d.Notes, func(i, j int) bool {
+			return d.Notes[i].Clipping.Metadata.Title < d.Notes[j].Clipping.Metadata.Title
+		})
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date.Before(days[j].Date) })
+	return days
+}
+
+// Path returns the path of the day's daily note in folder, / separated, named with format as Obsidian does.
+// The format may contain / to nest the notes, e.g. YYYY/MM/YYYY-MM-DD.
+func (d *Day) Path(folder string, format string) string {
+	return path.Join(folder, Format(d.Date, format)+".md")
+}
+
+// templateVariable matches the {{date}}, {{date:format}}, {{time}} and {{title}} variables of Obsidian templates.
+var templateVariable = regexp.MustCompile(`{{\s*(date|time|title)\s*(?::([^}]*))?}}`)
+
+// New returns a new daily note for the day from template, with its variables replaced, title being the note name.
+// {{date}} is the day formatted with format, {{time}} is now, the time the note is created, formatted with timeFormat,
+// HH:mm if it is "".
+func (d *Day) New(template []byte, title string, format string, timeFormat string, now time.Time) []byte {
+	return templateVariable.ReplaceAllFunc(template, func(v []byte) []byte {
+		m := templateVariable.FindSubmatch(v)
+		f := strings.TrimSpace(string(m[2]))
+		switch string(m[1]) {
+		case "title":
+			return []byte(title)
+		case "time":
+			if f == "" {
+				f = timeFormat
+			}
+			if f == "" {
+				f = "HH:mm"
+			}
+			return []byte(Format(now, f))
+		default:
+			if f == "" {
+				f = format
+			}
+		}
+		return []byte(Format(d.Date, f))
+	})
+}
+
+// AddSaved adds a link to each of the day's clippings not already linked from the Saved section of the note at from,
+// adding the section to the end of the note if it has none.
+// Returns the note and the number of links added, so rerunning never duplicates them.
+func (d *Day) AddSaved(content []byte, l vault.Links, from string) ([]byte, int) {
+	lines := strings.SplitAfter(string(content), "\n")
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if start < 0 && trimmed == Heading {
+			start = i
+		} else if start >= 0 && (strings.HasPrefix(trimmed, "# ") || strings.HasPrefix(trimmed, "## ")) {
+			end = i
+			break
+		}
+	}
+	section := ""
+	if start >= 0 {
+		section = strings.Join(lines[start+1:end], "")
+	}
+
+	var added []string
+	for _, n := range d.Notes {
+		if l.Linked(section, from, n.Path) {
+			continue
+		}
+		added = append(added, "- "+l.Link(from, n.Path, n.Clipping.Metadata.Title)+"\n")
+	}
+	if len(added) == 0 {
+		return content, 0
+	}
+
+	var b bytes.Buffer
+	if start < 0 {
+		b.Write(content)
+		if len(content) > 0 {
+			if !bytes.HasSuffix(content, []byte("\n")) {
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(Heading + "\n\n")
+		for _, line := range added {
+			b.WriteString(line)
+		}
+		return b.Bytes(), len(added)
+	}
+
+	// after the last line of the section which isn't blank
+	last := end - 1
+	for last > start && strings.TrimSpace(lines[last]) == "" {
+		last--
+	}
+	for _, line := range lines[:last+1] {
+		b.WriteString(line)
+	}
+	if !strings.HasSuffix(lines[last], "\n") {
+		b.WriteString("\n")
+	}
+	if last == start {
+		b.WriteString("\n")
+	}
+	for _, line := range added {
+		b.WriteString(line)
+	}
+	for _, line := range lines[last+1:] {
+		b.WriteString(line)
+	}
+	return b.Bytes(), len(added)
+}
+
+// formatTokens are the moment.js tokens Format supports, longest first.
+var formatTokens = []string{"YYYY", "MMMM", "dddd", "MMM", "ddd", "YY", "MM", "DD", "Do", "HH", "mm", "ss", "M", "D"}
+
+// Format formats t with a moment.js format, as used for daily notes in Obsidian, such as YYYY-MM-DD or
+// dddd, MMMM Do YYYY. Text in [brackets] is copied as is.
+func Format(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); {
+		if format[i] == '[' {
+			if end := strings.IndexByte(format[i:], ']'); end > 0 {
+				b.WriteString(format[i+1 : i+end])
+				i += end + 1
+				continue
+			}
+		}
+		token := ""
+		for _, t := range formatTokens {
+			if strings.HasPrefix(format[i:], t) {
+				token = t
+				break
+			}
+		}
+		switch token {
+		case "YYYY":
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case "YY":
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case "MMMM":
+			b.WriteString(t.Month().String())
+		case "MMM":
+			b.WriteString(t.Month().String()[:3])
+		case "MM":
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case "M":
+			fmt.Fprintf(&b, "%d", int(t.Month()))
+		case "DD":
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case "D":
+			fmt.Fprintf(&b, "%d", t.Day())
+		case "Do":
+			fmt.Fprintf(&b, "%d%s", t.Day(), ordinal(t.Day()))
+		case "dddd":
+			b.WriteString(t.Weekday().String())
+		case "ddd":
+			b.WriteString(t.Weekday().String()[:3])
+		case "HH":
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case "mm":
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case "ss":
+			fmt.Fprintf(&b, "%02d", t.Second())
+		default:
+			b.WriteByte(format[i])
+			i++
+			continue
+		}
+		i += len(token)
+	}
+	return b.String()
+}
+
+func ordinal(day int) string {
+	if day >= 11 && day <= 13 {
+		return "th"
+	}
+	switch day % 10 {
+	case 1:
+		return "st"
+	case 2:
+		return "nd"
+	case 3:
+		return "rd"
+	}
+	return "th"
+}
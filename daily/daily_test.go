@@ -0,0 +1,92 @@
+package daily
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"github.com/fergalsomers/pocket-obsidian/vault/vaulttest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDaily(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "daily suite")
+}
+
+// saved returns a clipping with the title, saved on the date.
+func saved(path string, title string, created string) vault.Note {
+	return vaulttest.Note(path, page.ClippingMetadata{Title: title, Created: created})
+}
+
+var _ = Describe("DailyTest", func() {
+
+	links := vault.Links{Root: vaulttest.Root}
+
+	notes := []vault.Note{
+		saved("Tech/Istio.md", "Istio | Traffic", "2025-05-16"),
+		saved("AI CEOs.md", "AI CEOs", "2025-05-16"),
+		saved("Aperture.md", "Aperture", "2023-09-20"),
+		saved("Undated.md", "Undated", ""),
+	}
+
+	It("Should group the notes by the day they were saved", func() {
+		days := Build(notes)
+		Expect(days).To(HaveLen(2))
+		Expect(days[0].Path("Daily", DefaultFormat)).To(Equal("Daily/2023-09-20.md"))
+		Expect(days[1].Path("", "YYYY/MM/dddd, MMMM Do YYYY")).To(Equal("2025/05/Friday, May 16th 2025.md"))
+		Expect(days[1].Notes[0].Clipping.Metadata.Title).To(Equal("AI CEOs"))
+	})
+
+	It("Should format dates as Obsidian does", func() {
+		t := time.Date(2025, time.January, 2, 15, 4, 5, 0, time.UTC)
+		Expect(Format(t, "YY-M-D ddd MMM [Week of] DD HH:mm:ss")).To(Equal("25-1-2 Thu Jan Week of 02 15:04:05"))
+		Expect(Format(t, "[YYYY] Do")).To(Equal("YYYY 2nd"))
+	})
+
+	It("Should create a daily note from a template", func() {
+		d := Build(notes)[1]
+		now := time.Date(2025, time.June, 1, 9, 41, 7, 0, time.Local)
+		Expect(string(d.New([]byte("# {{title}}\n{{date:dddd}} {{ date }} {{time}}\n"), "2025-05-16", DefaultFormat, "", now))).
+			To(Equal("# 2025-05-16\nFriday 2025-05-16 09:41\n"), "created now, not at midnight")
+		Expect(string(d.New([]byte("{{time:HH:mm}} {{time}}"), "2025-05-16", DefaultFormat, "HH:mm:ss", now))).
+			To(Equal("09:41 09:41:07"))
+	})
+
+	It("Should add a Saved section with the day's clippings", func() {
+		d := Build(notes)[1]
+		content, added := d.AddSaved([]byte("# Friday\n\nMeeting notes"), links, "vault/Daily/2025-05-16.md")
+		Expect(added).To(Equal(2))
+		Expect(string(content)).To(Equal("# Friday\n\nMeeting notes\n\n## Saved\n\n- [[AI CEOs]]\n- [[Tech/Istio|Istio - Traffic]]\n"))
+
+		again, added := d.AddSaved(content, links, "vault/Daily/2025-05-16.md")
+		Expect(added).To(Equal(0), "rerunning doesn't duplicate the links")
+		Expect(string(again)).To(Equal(string(content)))
+	})
+
+	It("Should only add the missing links to an existing Saved section", func() {
+		d := Build(notes)[1]
+		content, added := d.AddSaved([]byte("## Saved\n- [[AI CEOs|my favourite]]\n\n## Later\n- [[Tech/Istio]]\n"), links, "vault/Daily/2025-05-16.md")
+		Expect(added).To(Equal(1))
+		Expect(string(content)).To(Equal("## Saved\n- [[AI CEOs|my favourite]]\n- [[Tech/Istio|Istio - Traffic]]\n\n## Later\n- [[Tech/Istio]]\n"))
+
+		content, added = d.AddSaved([]byte("## Saved"), links, "vault/Daily/2025-05-16.md")
+		Expect(added).To(Equal(2))
+		Expect(string(content)).To(Equal("## Saved\n\n- [[AI CEOs]]\n- [[Tech/Istio|Istio - Traffic]]\n"))
+	})
+
+	It("Should link as the vault is set to", func() {
+		d := Build(notes)[1]
+		markdown := vault.Links{Root: vaulttest.Root, Format: vault.LinkRelative, Markdown: true}
+		content, added := d.AddSaved([]byte("## Saved\n- [[AI CEOs]]\n"), markdown, "vault/Daily/2025-05-16.md")
+		Expect(added).To(Equal(1), "wikilinks count too")
+		Expect(string(content)).To(Equal("## Saved\n- [[AI CEOs]]\n- [Istio | Traffic](../Tech/Istio.md)\n"))
+		_, added = d.AddSaved(content, links, "vault/Daily/2025-05-16.md")
+		Expect(added).To(Equal(1), "a relative link isn't the absolute one")
+		_, added = d.AddSaved(content, markdown, "vault/Daily/2025-05-16.md")
+		Expect(added).To(Equal(0))
+	})
+})
@@ -0,0 +1,89 @@
+package dashboard
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// GeneratedKind is the vault.KindKey of the dashboard notes.
+const GeneratedKind = "dashboard"
+
+// File is a dashboard, to write to a folder of the vault.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// Generated reports whether the file is a note, marked with vault.GeneratedKey, rather than a base.
+func (f File) Generated() bool {
+	return path.Ext(f.Name) == ".md"
+}
+
+// unreadByDomainBase is an Obsidian Bases table of the unread clippings grouped by domain.
+const unreadByDomainBase = `filters:
+  and:
+    - file.hasProperty("source")
+    - status == "unread"
+views:
+  - type: table
+    name: Unread by domain
+    groupBy:
+      property: domain
+      direction: ASC
+    order:
+      - file.name
+      - domain
+      - created
+      - reading_time
+    sort:
+      - property: created
+        direction: DESC
+`
+
+// recentlySavedBase is an Obsidian Bases table of the latest clippings.
+const recentlySavedBase = `filters:
+  and:
+    - file.hasProperty("source")
+views:
+  - type: table
+    name: Recently saved
+    order:
+      - file.name
+      - domain
+      - created
+      - status
+      - reading_time
+    sort:
+      - property: created
+        direction: DESC
+    limit: 50
+`
+
+const unreadByDomainQuery = `TABLE WITHOUT ID domain AS Domain, length(rows) AS Unread, rows.file.link AS Clippings
+WHERE source AND status = "unread"
+GROUP BY domain
+SORT length(rows) DESC`
+
+const recentlySavedQuery = `TABLE domain AS Domain, created AS Saved, reading_time AS Minutes, status AS Status
+WHERE source AND created
+SORT created DESC
+LIMIT 50`
+
+// Files returns the dashboards to write to folder of the vault: a base and a Dataview note for the unread
+// clippings by domain and for those saved most recently.
+func Files(folder string) []File {
+	return []File{
+		{Name: path.Join(folder, "Unread by domain.base"), Content: []byte(unreadByDomainBase)},
+		{Name: path.Join(folder, "Recently saved.base"), Content: []byte(recentlySavedBase)},
+		{Name: path.Join(folder, "Unread by domain (Dataview).md"), Content: note("Unread by domain", unreadByDomainQuery)},
+		{Name: path.Join(folder, "Recently saved (Dataview).md"), Content: note("Recently saved", recentlySavedQuery)},
+	}
+}
+
+// note returns a generated note running a Dataview query.
+func note(title string, query string) []byte {
+	return []byte(fmt.Sprintf("---\n%s: %s\n%s: %s\n---\n# %s\n\n%s\n\n_Needs the Dataview plugin._\n\n```dataview\n%s\n```\n",
+		vault.GeneratedKey, vault.GeneratedBy, vault.KindKey, GeneratedKind, title, vault.GeneratedNotice, query))
+}
@@ -0,0 +1,45 @@
+package dashboard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"gopkg.in/yaml.v3"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDashboard(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "dashboard suite")
+}
+
+var _ = Describe("DashboardTest", func() {
+
+	It("Should generate bases and Dataview notes", func() {
+		files := Files("Dashboards")
+		Expect(files).To(HaveLen(4))
+		dir := GinkgoT().TempDir()
+		for _, f := range files {
+			Expect(f.Name).To(HavePrefix("Dashboards/"))
+			path := filepath.Join(dir, filepath.Base(f.Name))
+			Expect(os.WriteFile(path, f.Content, 0644)).To(Succeed())
+			if f.Generated() {
+				Expect(string(f.Content)).To(ContainSubstring("```dataview\n"))
+				Expect(vault.Generated(path)).To(BeTrue(), f.Name)
+				continue
+			}
+			var base struct {
+				Filters map[string][]string
+				Views   []map[string]any
+			}
+			Expect(yaml.Unmarshal(f.Content, &base)).To(Succeed(), f.Name)
+			Expect(base.Filters["and"]).To(ContainElement(`file.hasProperty("source")`))
+			Expect(base.Views).To(HaveLen(1))
+			Expect(base.Views[0]).To(HaveKeyWithValue("type", "table"))
+		}
+	})
+})
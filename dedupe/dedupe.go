@@ -0,0 +1,109 @@
+package dedupe
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/source"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// ErrDuplicate is returned (wrapped) for an item whose article has already been clipped.
+var ErrDuplicate = errors.New("duplicate")
+
+// Items merges items for the same article, keeping the first.
+// Tags of the dropped duplicates are added to the kept item. Returns the kept items and the number dropped.
+func Items(items []*source.Item) ([]*source.Item, int) {
+	kept := make([]*source.Item, 0, len(items))
+	byKey := map[string]*source.Item{}
+	for _, item := range items {
+		key := canonical.Key(item.URL)
+		first, ok := byKey[key]
+		if !ok {
+			copied := *item
+			byKey[key] = &copied
+			kept = append(kept, &copied)
+			continue
+		}
+		first.Tags = page.MergeTags(first.Tags, item.Tags)
+	}
+	return kept, len(items) - len(kept)
+}
+
+// Index maps article URLs to the path of the note they are clipped to, it is safe for concurrent use.
+// Tags of duplicates are collected against the path of the note until they are drained, to be merged into it.
+type Index struct {
+	mu     sync.Mutex
+	paths  map[string]string
+	merges map[string][]string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		paths:  map[string]string{},
+		merges: map[string][]string{},
+	}
+}
+
+// Load indexes the clippings already in dir by their source URL. When dir is in an Obsidian vault,
+// the clippings anywhere in the vault are indexed.
+func Load(dir string) (*Index, error) {
+	if root, ok := vault.Find(dir); ok {
+		dir = root
+	}
+	notes, err := vault.Scan(dir)
+	if err != nil {
+		return nil, err
+	}
+	index := NewIndex()
+	for _, n := range notes {
+		index.Claim(n.Clipping.Metadata.Source, n.Path)
+	}
+	return index, nil
+}
+
+// Lookup returns the path of the note already clipped for url.
+func (i *Index) Lookup(url string) (string, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	path, ok := i.paths[canonical.Key(url)]
+	return path, ok
+}
+
+// Claim records that url is clipped to path, unless it has already been claimed.
+// Returns the path of the note holding the article and whether this call claimed it.
+func (i *Index) Claim(url string, path string) (string, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	key := canonical.Key(url)
+	if existing, ok := i.paths[key]; ok {
+		return existing, false
+	}
+	i.paths[key] = path
+	return path, true
+}
+
+// Merge notes that tags should be added to the note at path.
+func (i *Index) Merge(path string, tags []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.merges[path] = page.MergeTags(i.merges[path], tags)
+}
+
+// Drain returns the tags to add to each note path, forgetting them so they are only merged once.
+func (i *Index) Drain() map[string][]string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	merges := i.merges
+	i.merges = map[string][]string{}
+	return merges
+}
+
+// Len returns the number of articles in the index.
+func (i *Index) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.paths)
+}
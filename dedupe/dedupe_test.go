@@ -0,0 +1,92 @@
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/source"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDedupe(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "dedupe suite")
+}
+
+var _ = Describe("DedupeTest", func() {
+
+	It("Should merge duplicate items keeping the first", func() {
+		items := []*source.Item{
+			{Title: "AI CEOs", URL: "https://hbr.org/2024/09/ai-ceos", Tags: []string{"ai"}},
+			{Title: "Istio", URL: "https://aws.amazon.com/blogs/istio/", Tags: []string{"istio"}},
+			{Title: "AI CEOs", URL: "http://www.hbr.org/2024/09/ai-ceos/?utm_source=pocket", Tags: []string{"ceo", "AI"}},
+			{Title: "AI CEOs", URL: "https://hbr.org/2024/09/ai-ceos#comments", Read: true},
+		}
+		kept, dropped := Items(items)
+		Expect(dropped).To(Equal(2))
+		Expect(kept).To(HaveLen(2))
+		Expect(kept[0].URL).To(Equal("https://hbr.org/2024/09/ai-ceos"))
+		Expect(kept[0].Tags).To(Equal([]string{"ai", "ceo"}))
+		Expect(kept[0].Read).To(BeFalse())
+		Expect(kept[1].URL).To(Equal("https://aws.amazon.com/blogs/istio/"))
+		Expect(items[0].Tags).To(Equal([]string{"ai"}), "input items should not be modified")
+	})
+
+	It("Should claim each article once", func() {
+		index := NewIndex()
+		path, claimed := index.Claim("https://hbr.org/a", "archive/A.md")
+		Expect(claimed).To(BeTrue())
+		Expect(path).To(Equal("archive/A.md"))
+
+		path, claimed = index.Claim("http://hbr.org/a/?utm_medium=email", "archive/A copy.md")
+		Expect(claimed).To(BeFalse())
+		Expect(path).To(Equal("archive/A.md"))
+
+		path, ok := index.Lookup("https://www.hbr.org/a")
+		Expect(ok).To(BeTrue())
+		Expect(path).To(Equal("archive/A.md"))
+		_, ok = index.Lookup("https://hbr.org/b")
+		Expect(ok).To(BeFalse())
+		Expect(index.Len()).To(Equal(1))
+	})
+
+	It("Should collect tags to merge", func() {
+		index := NewIndex()
+		index.Merge("archive/A.md", []string{"ai", "ceo"})
+		index.Merge("archive/A.md", []string{"AI", "business"})
+		Expect(index.Drain()).To(Equal(map[string][]string{"archive/A.md": {"ai", "ceo", "business"}}))
+		Expect(index.Drain()).To(BeEmpty(), "merged once")
+	})
+
+	It("Should index the clippings of the whole vault", func() {
+		root := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(root, ".obsidian"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, ".obsidian", "app.json"), []byte(`{"newFileLocation": "folder", "newFileFolderPath": "Inbox"}`), 0644)).To(Succeed())
+		old := filepath.Join(root, "Reading", "AI CEOs.md")
+		Expect(os.MkdirAll(filepath.Dir(old), 0755)).To(Succeed())
+		Expect(os.WriteFile(old, []byte("---\ntitle: AI CEOs\nsource: https://hbr.org/2024/09/ai-ceos\n---\n# AI CEOs\n"), 0644)).To(Succeed())
+
+		// clipped outside the folder the new clippings are written to
+		for _, dir := range []string{root, filepath.Join(root, "Inbox")} {
+			index, err := Load(dir)
+			Expect(err).To(BeNil())
+			path, ok := index.Lookup("https://hbr.org/2024/09/ai-ceos?utm_source=pocket")
+			Expect(ok).To(BeTrue(), dir)
+			Expect(path).To(Equal(old))
+		}
+
+		index, err := Load(filepath.Join(GinkgoT().TempDir(), "missing"))
+		Expect(err).To(BeNil())
+		Expect(index.Len()).To(Equal(0))
+	})
+
+	It("Should wrap ErrDuplicate", func() {
+		err := fmt.Errorf("%w of %s", ErrDuplicate, "archive/A.md")
+		Expect(errors.Is(err, ErrDuplicate)).To(BeTrue())
+	})
+})
@@ -0,0 +1,97 @@
+package filter
+
+import (
+	"fmt"
+	nurl "net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+)
+
+// Filter selects which pages from the input are processed.
+// Zero values don't filter, so an empty Filter matches every page.
+type Filter struct {
+	IncludeTags  []string       // keep pages with at least one of these tags
+	ExcludeTags  []string       // drop pages with any of these tags
+	UnreadOnly   bool           // drop pages already read
+	AddedAfter   time.Time      // drop pages added before this time
+	AddedBefore  time.Time      // drop pages added at or after this time
+	AllowDomains []string       // keep pages from these domains (or their sub-domains)
+	DenyDomains  []string       // drop pages from these domains (or their sub-domains)
+	Title        *regexp.Regexp // keep pages with a matching title
+}
+
+// Match reports whether the page passes every condition of the filter.
+// Tags and read status are those of the input record, before any mandatory tags or --read are applied.
+func (f *Filter) Match(p *page.Page) bool {
+	if len(f.IncludeTags) > 0 && !hasAnyTag(p.Tags, f.IncludeTags) {
+		return false
+	}
+	if hasAnyTag(p.Tags, f.ExcludeTags) {
+		return false
+	}
+	if f.UnreadOnly && p.Read {
+		return false
+	}
+	added := time.Unix(p.TimeAdded, 0)
+	if !f.AddedAfter.IsZero() && added.Before(f.AddedAfter) {
+		return false
+	}
+	if !f.AddedBefore.IsZero() && !added.Before(f.AddedBefore) {
+		return false
+	}
+	if len(f.AllowDomains) > 0 || len(f.DenyDomains) > 0 {
+		host := Host(p.Url)
+		if len(f.AllowDomains) > 0 && !inAnyDomain(host, f.AllowDomains) {
+			return false
+		}
+		if inAnyDomain(host, f.DenyDomains) {
+			return false
+		}
+	}
+	if f.Title != nil && !f.Title.MatchString(p.Title) {
+		return false
+	}
+	return true
+}
+
+// ParseDate parses a YYYY-MM-DD date in local time, as used by the --added-* flags.
+func ParseDate(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s, expected YYYY-MM-DD: %w", s, err)
+	}
+	return t, nil
+}
+
+// Host returns the lower case host name of url, or "" if it can't be parsed.
+func Host(url string) string {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func hasAnyTag(tags []string, wanted []string) bool {
+	for _, t := range tags {
+		for _, w := range wanted {
+			if strings.EqualFold(t, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inAnyDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
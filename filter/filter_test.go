@@ -0,0 +1,76 @@
+package filter
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFilter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "filter suite")
+}
+
+func testPage() *page.Page {
+	return &page.Page{
+		Title:     "AI Can (Mostly) Outperform Human CEOs",
+		Url:       "https://www.hbr.org/2024/09/ai-can-mostly-outperform-human-ceos",
+		TimeAdded: time.Date(2024, 9, 15, 12, 0, 0, 0, time.Local).Unix(),
+		Tags:      []string{"ai", "ceo"},
+		Read:      false,
+	}
+}
+
+var _ = Describe("FilterTest", func() {
+
+	It("Should match everything when empty", func() {
+		f := Filter{}
+		Expect(f.Match(testPage())).To(BeTrue())
+	})
+
+	It("Should include and exclude tags", func() {
+		Expect((&Filter{IncludeTags: []string{"AI"}}).Match(testPage())).To(BeTrue())
+		Expect((&Filter{IncludeTags: []string{"photography"}}).Match(testPage())).To(BeFalse())
+		Expect((&Filter{ExcludeTags: []string{"ceo"}}).Match(testPage())).To(BeFalse())
+		Expect((&Filter{IncludeTags: []string{"ai"}, ExcludeTags: []string{"istio"}}).Match(testPage())).To(BeTrue())
+	})
+
+	It("Should drop read pages when unread only", func() {
+		p := testPage()
+		f := Filter{UnreadOnly: true}
+		Expect(f.Match(p)).To(BeTrue())
+		p.Read = true
+		Expect(f.Match(p)).To(BeFalse())
+	})
+
+	It("Should filter on the date range", func() {
+		after, err := ParseDate("2024-09-15")
+		Expect(err).To(BeNil())
+		before, err := ParseDate("2024-09-16")
+		Expect(err).To(BeNil())
+		Expect((&Filter{AddedAfter: after, AddedBefore: before}).Match(testPage())).To(BeTrue())
+		Expect((&Filter{AddedBefore: after}).Match(testPage())).To(BeFalse())
+
+		after, _ = ParseDate("2024-09-16")
+		Expect((&Filter{AddedAfter: after}).Match(testPage())).To(BeFalse())
+
+		_, err = ParseDate("15/09/2024")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Should allow and deny domains including sub-domains", func() {
+		Expect((&Filter{AllowDomains: []string{"hbr.org"}}).Match(testPage())).To(BeTrue())
+		Expect((&Filter{AllowDomains: []string{"medium.com"}}).Match(testPage())).To(BeFalse())
+		Expect((&Filter{DenyDomains: []string{"HBR.org"}}).Match(testPage())).To(BeFalse())
+		Expect((&Filter{DenyDomains: []string{"br.org"}}).Match(testPage())).To(BeTrue())
+	})
+
+	It("Should match the title against a regex", func() {
+		Expect((&Filter{Title: regexp.MustCompile(`(?i)ceos?\b`)}).Match(testPage())).To(BeTrue())
+		Expect((&Filter{Title: regexp.MustCompile(`^Kubernetes`)}).Match(testPage())).To(BeFalse())
+	})
+})
@@ -0,0 +1,126 @@
+package moc
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fergalsomers/pocket-obsidian/filter"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// GeneratedKind is the vault.KindKey of the maps of content.
+const GeneratedKind = "moc"
+
+// Kinds of map of content, each is written to a sub-folder of the same name.
+const (
+	KindTag    = "Tags"
+	KindDomain = "Domains"
+	KindMonth  = "Months"
+)
+
+// MOC is a map of content: a generated index note listing the clippings with a tag, from a domain or added in a month.
+type MOC struct {
+	Kind  string
+	Name  string // the tag, domain or month (YYYY-MM)
+	Notes []vault.Note
+}
+
+// Path returns the path of the note, relative to the folder of the maps of content and / separated.
+// Nested tags are nested folders.
+func (m *MOC) Path() string {
+	return path.Join(m.Kind, m.Name+".md")
+}
+
+// Build returns the maps of content for the notes: one per tag, domain and month, in that order and sorted by name.
+func Build(notes []vault.Note) []*MOC {
+	byKey := map[string]*MOC{}
+	add := func(kind string, name string, n vault.Note) {
+		name = strings.Trim(strings.NewReplacer("\\", "-", ":", "-", "..", "-").Replace(name), "/ ")
+		if name == "" {
+			return
+		}
+		key := kind + "/" + strings.ToLower(name)
+		m, ok := byKey[key]
+		if !ok {
+			m = &MOC{Kind: kind, Name: name}
+			byKey[key] = m
+		}
+		m.Notes = append(m.Notes, n)
+	}
+	for _, n := range notes {
+		md := n.Clipping.Metadata
+		for _, t := range md.Tags {
+			add(KindTag, t, n)
+		}
+		add(KindDomain, strings.TrimPrefix(filter.Host(md.Source), "www."), n)
+		if len(md.Created) >= len("2006-01") {
+			add(KindMonth, md.Created[:len("2006-01")], n)
+		}
+	}
+
+	order := map[string]int{KindTag: 0, KindDomain: 1, KindMonth: 2}
+	mocs := make([]*MOC, 0, len(byKey))
+	for _, m := range byKey {
+		sort.SliceStable(m.Notes, func(i, j int) bool {
+			a, b := m.Notes[i].Clipping.Metadata, m.Notes[j].Clipping.Metadata
+			if a.Created != b.Created {
+				return a.Created > b.Created // newest first
+			}
+			return a.Title < b.Title
+		})
+		mocs = append(mocs, m)
+	}
+	sort.Slice(mocs, func(i, j int) bool {
+		if mocs[i].Kind != mocs[j].Kind {
+			return order[mocs[i].Kind] < order[mocs[j].Kind]
+		}
+		return mocs[i].Name < mocs[j].Name
+	})
+	return mocs
+}
+
+// Markdown returns the note, to be written to from: each clipping as a link with its read state
+// and description, as a checked item if it has been read.
+func (m *MOC) Markdown(l vault.Links, from string) []byte {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "%s: %s\n", vault.GeneratedKey, vault.GeneratedBy)
+	fmt.Fprintf(&b, "%s: %s\n", vault.KindKey, GeneratedKind)
+	fmt.Fprintf(&b, "moc: %s\n", strings.ToLower(strings.TrimSuffix(m.Kind, "s")))
+	fmt.Fprintf(&b, "count: %d\n", len(m.Notes))
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "# %s\n\n", m.title())
+	b.WriteString(vault.GeneratedNotice + "\n\n")
+	for _, n := range m.Notes {
+		md := n.Clipping.Metadata
+		check := " "
+		if md.Read {
+			check = "x"
+		}
+		fmt.Fprintf(&b, "- [%s] %s", check, l.Link(from, n.Path, md.Title))
+		if description := strings.Join(strings.Fields(md.Description), " "); description != "" {
+			fmt.Fprintf(&b, " — %s", description)
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+func (m *MOC) title() string {
+	if m.Kind == KindMonth {
+		return "Saved in " + m.Name
+	}
+	return m.Name // not #tag, that would tag this note too
+}
+
+// Paths returns the paths the maps of content are written to below dir, as a set for vault.RemoveStale.
+func Paths(dir string, mocs []*MOC) map[string]bool {
+	paths := map[string]bool{}
+	for _, m := range mocs {
+		paths[filepath.Join(dir, filepath.FromSlash(m.Path()))] = true
+	}
+	return paths
+}
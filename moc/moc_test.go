@@ -0,0 +1,60 @@
+package moc
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"github.com/fergalsomers/pocket-obsidian/vault/vaulttest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMOC(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "moc suite")
+}
+
+var _ = Describe("MOCTest", func() {
+
+	notes := []vault.Note{
+		vaulttest.Note("AI CEOs.md", page.ClippingMetadata{Title: "AI CEOs", Source: "https://www.hbr.org/ai-ceos", Created: "2025-05-22", Tags: []string{"ai", "topic/business"}, Description: "AI can\noutperform CEOs", Read: true}),
+		vaulttest.Note("Tech/Istio.md", page.ClippingMetadata{Title: "Istio | Traffic", Source: "https://aws.amazon.com/istio", Created: "2025-05-16", Tags: []string{"AI"}}),
+		vaulttest.Note("Aperture.md", page.ClippingMetadata{Title: "Aperture", Source: "https://hbr.org/aperture", Created: "2023-09-20"}),
+	}
+
+	It("Should build a map of content per tag, domain and month", func() {
+		mocs := Build(notes)
+		paths := []string{}
+		for _, m := range mocs {
+			paths = append(paths, m.Path())
+		}
+		Expect(paths).To(Equal([]string{
+			"Tags/ai.md", "Tags/topic/business.md",
+			"Domains/aws.amazon.com.md", "Domains/hbr.org.md",
+			"Months/2023-09.md", "Months/2025-05.md",
+		}))
+		Expect(mocs[0].Notes).To(HaveLen(2), "tags are matched ignoring case")
+		Expect(mocs[0].Notes[0].Clipping.Metadata.Title).To(Equal("AI CEOs"), "newest first")
+		Expect(Paths("MOCs", mocs)).To(HaveKey(filepath.Join("MOCs", "Tags", "topic", "business.md")))
+	})
+
+	It("Should list the clippings as links", func() {
+		m := Build(notes)[0]
+		Expect(string(m.Markdown(vault.Links{Root: vaulttest.Root}, "vault/MOCs/Tags/ai.md"))).To(Equal(`---
+generated_by: pocket-obsidian
+generated_kind: moc
+moc: tag
+count: 2
+---
+# ai
+
+_Generated by pocket-obsidian, changes are overwritten._
+
+- [x] [[AI CEOs]] — AI can outperform CEOs
+- [ ] [[Tech/Istio|Istio - Traffic]]
+`))
+	})
+})
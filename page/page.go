@@ -4,16 +4,16 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	nurl "net/url"
-	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"github.com/fergalsomers/pocket-obsidian/canonical"
 	"github.com/flytam/filenamify"
 	readability "github.com/go-shiori/go-readability"
 	"golang.org/x/net/html"
@@ -21,11 +21,21 @@ import (
 )
 
 type Page struct {
-	Title     string   `yaml:"title"`
-	Url       string   `yaml:"url"`
-	TimeAdded int64    `yaml:"time_added"`
-	Tags      []string `yaml:"tags"`
-	Read      bool     `yaml:"read"`
+	Title      string      `yaml:"title"`
+	Url        string      `yaml:"url"`
+	TimeAdded  int64       `yaml:"time_added"`
+	Tags       []string    `yaml:"tags"`
+	Read       bool        `yaml:"read"`
+	Highlights []Highlight `yaml:"highlights,omitempty"`
+	Folder     string      `yaml:"folder,omitempty"` // sub-directory of the output directory to write the note to
+	Starred    bool        `yaml:"starred,omitempty"`
+	HTML       string      `yaml:"-"` // the stored article, if set it is used instead of retrieving the page
+}
+
+// Highlight is a passage of the article highlighted in Pocket.
+type Highlight struct {
+	Quote     string `yaml:"quote" json:"quote"`
+	CreatedAt int64  `yaml:"created_at" json:"created_at"`
 }
 
 func (p *Page) YamlBytes() []byte {
@@ -54,16 +64,44 @@ func RecordToPage(record []string, markRead bool, mandatoryTags []string) (*Page
 	if err != nil {
 		return nil, fmt.Errorf("error parsing time_added [%s]: %w", record[2], err)
 	}
+	// copy the mandatory tags, they are shared between records
+	tags := append([]string{}, mandatoryTags...)
+	for _, t := range strings.Split(record[3], "|") {
+		if t != "" {
+			tags = append(tags, t)
+		}
+	}
 	page := Page{
 		Title:     record[0],
 		Url:       record[1],
 		TimeAdded: timeAdded,
-		Tags:      append(mandatoryTags, strings.Split(record[3], "|")...),
+		Tags:      tags,
 		Read:      record[4] != "unread" || markRead,
 	}
 	return &page, nil
 }
 
+// MergeTags returns tags with any of more that it doesn't already contain appended, ignoring case and empty tags.
+func MergeTags(tags []string, more []string) []string {
+	merged := append([]string{}, tags...)
+	for _, t := range more {
+		if t == "" {
+			continue
+		}
+		found := false
+		for _, m := range merged {
+			if strings.EqualFold(m, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
 func ToMarkdown(input []byte) ([]byte, error) {
 	// Convert HTML to Markdown
 	return htmltomarkdown.ConvertReader(bytes.NewReader(input))
@@ -74,10 +112,38 @@ type ClippingMetadata struct {
 	Source      string   `yaml:"source"`
 	Author      []string `yaml:"author"`
 	Published   string   `yaml:"published"`
-	Created     string   `yaml:"created"`
+	Created     string   `yaml:"created"` // when it was saved, as a DateTimeLayout
 	Description string   `yaml:"description"`
 	Tags        []string `yaml:"tags"`
 	Read        bool     `yaml:"read"`
+	Status      string   `yaml:"status,omitempty"` // StatusRead or StatusUnread, for Bases and Dataview queries
+	Domain      string   `yaml:"domain,omitempty"` // host of the source, without www.
+	Site        string   `yaml:"site,omitempty"`   // name of the site, or a link to its note
+	WordCount   int      `yaml:"word_count,omitempty"`
+	ReadingTime int      `yaml:"reading_time,omitempty"` // minutes
+	Highlights  int      `yaml:"highlights,omitempty"`
+	Starred     bool     `yaml:"starred,omitempty"`
+	Snapshot    string   `yaml:"snapshot,omitempty"` // link to the HTML snapshot of the article
+}
+
+// DateTimeLayout is the layout of the created property, an ISO 8601 local date time as Obsidian's datetime properties use.
+const DateTimeLayout = "2006-01-02T15:04:05"
+
+// Values of the status property.
+const (
+	StatusRead   = "read"
+	StatusUnread = "unread"
+)
+
+// wordsPerMinute is the reading speed reading_time is estimated with.
+const wordsPerMinute = 200
+
+// Status returns the status property for the read state.
+func Status(read bool) string {
+	if read {
+		return StatusRead
+	}
+	return StatusUnread
 }
 
 func (c *ClippingMetadata) YamlBytes() []byte {
@@ -92,24 +158,104 @@ func (c *ClippingMetadata) YamlBytes() []byte {
 func NewClipping(p *Page, markdownContent []byte) *Clipping {
 
 	unixTimeUTC := time.Unix(p.TimeAdded, 0)
-	dateAdded := unixTimeUTC.Format(time.DateOnly)
+	timeAdded := unixTimeUTC.Format(DateTimeLayout)
+	source := canonical.Clean(p.Url)
 
 	return &Clipping{
 		Metadata: ClippingMetadata{
 			Title:   p.Title,
-			Source:  p.Url,
-			Created: dateAdded,
+			Source:  source,
+			Created: timeAdded,
 			Tags:    p.Tags,
 			Read:    p.Read,
+			Status:  Status(p.Read),
+			Domain:  canonical.Domain(source),
+			Site:    canonical.Domain(source),
+			Starred: p.Starred,
 			Author:  []string{}, // Placeholder for author, can be populated later
 		},
 		MarkdownContent: markdownContent,
+		Highlights:      p.Highlights,
+		Folder:          p.Folder,
+	}
+}
+
+// markdownSyntax matches the Markdown a highlight mustn't be marked inside of: code blocks and spans,
+// images, link targets and autolinks or HTML tags.
+var markdownSyntax = regexp.MustCompile("(?ms)^(```|~~~).*?^(```|~~~)|`[^`\n]*`|!\\[[^\\]\n]*\\]\\([^)\n]*\\)|\\]\\([^)\n]*\\)|<[^>\n]+>")
+
+// markFirst marks the first occurrence of quote in the Markdown content with ==quote==, where it is in the text.
+func markFirst(content string, quote string) string {
+	syntax := markdownSyntax.FindAllStringIndex(content, -1)
+	for from := 0; ; {
+		i := strings.Index(content[from:], quote)
+		if i < 0 {
+			return content
+		}
+		start, end := from+i, from+i+len(quote)
+		inside := false
+		for _, r := range syntax {
+			if start < r[1] && end > r[0] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return content[:start] + "==" + quote + "==" + content[end:]
+		}
+		from = start + 1
 	}
 }
 
 type Clipping struct {
 	Metadata        ClippingMetadata
 	MarkdownContent []byte
+	Highlights      []Highlight // rendered into the markdown by AddHighlights
+	Folder          string      // sub-directory of the output directory
+	Article         *Article    // the article the clipping was converted from, if it was retrieved
+}
+
+const (
+	HighlightsQuote   = "quote"   // render highlights as blockquotes
+	HighlightsCallout = "callout" // render highlights as Obsidian quote callouts
+)
+
+// AddHighlights appends a Highlights section to the markdown content and sets the highlights count property.
+// style is HighlightsQuote or HighlightsCallout. If mark is set, the first occurrence of each highlighted
+// passage in the content is also marked with ==text==.
+func (c *Clipping) AddHighlights(style string, mark bool) {
+	if len(c.Highlights) == 0 {
+		return
+	}
+	c.Metadata.Highlights = len(c.Highlights)
+
+	content := string(c.MarkdownContent)
+	if mark {
+		for _, h := range c.Highlights {
+			quote := strings.TrimSpace(h.Quote)
+			if quote != "" && !strings.Contains(quote, "\n") {
+				content = markFirst(content, quote)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(content, "\n"))
+	b.WriteString("\n\n## Highlights\n")
+	for _, h := range c.Highlights {
+		created := time.Unix(h.CreatedAt, 0).Format("2006-01-02 15:04")
+		b.WriteString("\n")
+		if style == HighlightsCallout {
+			fmt.Fprintf(&b, "> [!quote] %s\n", created)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(h.Quote), "\n") {
+			fmt.Fprintf(&b, "> %s\n", line)
+		}
+		if style != HighlightsCallout {
+			fmt.Fprintf(&b, ">\n> *%s*\n", created)
+		}
+	}
+	c.MarkdownContent = []byte(b.String())
 }
 
 func ReadClippingMetadataYamlBytes(b []byte) (*ClippingMetadata, error) {
@@ -148,7 +294,8 @@ func ReadClipping(r io.Reader) (*Clipping, error) {
 		return nil, fmt.Errorf("error reading clipping: %w", err)
 	}
 
-	parts := bytes.Split(b, ByteDelimiter)
+	// the markdown content may contain more delimiters (horizontal rules), so only split off the frontmatter
+	parts := bytes.SplitN(b, ByteDelimiter, 3)
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("clipping does not contain enough parts, expected at least 2, got %d", len(parts))
 	}
@@ -181,6 +328,18 @@ func (c *Clipping) Decorate(a *Article) {
 	if a.Title != "" {
 		c.Metadata.Title = a.Title
 	}
+	if a.Canonical != "" && canonical.SameSite(a.Canonical, c.Metadata.Source) {
+		c.Metadata.Source = canonical.Clean(a.Canonical)
+		c.Metadata.Domain = canonical.Domain(c.Metadata.Source)
+		c.Metadata.Site = c.Metadata.Domain
+	}
+	if a.SiteName != "" {
+		c.Metadata.Site = a.SiteName
+	}
+	if words := len(strings.Fields(a.Text)); words > 0 {
+		c.Metadata.WordCount = words
+		c.Metadata.ReadingTime = (words + wordsPerMinute - 1) / wordsPerMinute
+	}
 
 	md, err := htmltomarkdown.ConvertString(a.Content)
 	if err == nil {
@@ -202,7 +361,10 @@ type Article struct {
 	Description string
 	Published   string
 	Authors     []string
+	Canonical   string // the <link rel="canonical"> URL declared by the page, if any
 	Content     string
+	Text        string // the text of Content, without markup
+	SiteName    string
 	Node        *html.Node
 }
 
@@ -253,12 +415,32 @@ func (h *httpContnetRetriever) Get(url string) ([]byte, string, error) {
 	return content, contentType, nil
 }
 
-func NewContentRetriever() ContentRetriever {
-	return &httpContnetRetriever{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+// GetResource retrieves a resource of a page, such as an image, whatever its content type.
+func (h *httpContnetRetriever) GetResource(url string) ([]byte, string, error) {
+	resp, err := h.client.Get(url)
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching URL %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error retrieving URL code: %d, %s", resp.StatusCode, url)
 	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %s: %w", url, err)
+	}
+	return content, resp.Header.Get("content-type"), nil
+}
+
+func NewContentRetriever() ContentRetriever {
+	return NewHTTPContentRetriever(&http.Client{
+		Timeout: 10 * time.Second,
+	})
+}
+
+// NewHTTPContentRetriever retrieves pages with client, for example one with a recording transport.
+func NewHTTPContentRetriever(client *http.Client) ContentRetriever {
+	return &httpContnetRetriever{client: client}
 }
 
 func ExtractArticleFromContent(c ContentRetriever, url string) (*Article, error) {
@@ -269,14 +451,14 @@ func ExtractArticleFromContent(c ContentRetriever, url string) (*Article, error)
 	if content == nil {
 		return nil, nil
 	}
+	return ExtractArticleFromHTML(content, url)
+}
 
-	node, err := html.Parse(bytes.NewReader(content))
-	if err != nil {
-		return nil, fmt.Errorf("error parsing HTML: %w", err)
-	}
-	article, err := getArticleMetadataFromNode(node, url)
+// ExtractArticleFromHTML extracts the article from the HTML of the page at url, without retrieving anything.
+func ExtractArticleFromHTML(content []byte, url string) (*Article, error) {
+	article, err := getArticleMetadataFromReader(bytes.NewReader(content), url)
 	if err != nil {
-		log.Printf("error extracting metadata from HTML: %v", err)
+		return nil, fmt.Errorf("error extracting metadata from HTML: %w", err)
 	}
 
 	if strings.HasPrefix(article.Description, medium404desc) {
@@ -313,6 +495,9 @@ func getArticleMetadataFromNode(node *html.Node, url string) (*Article, error) {
 		Title:       article.Title,
 		Description: article.Excerpt,
 		Content:     article.Content,
+		Text:        article.TextContent,
+		SiteName:    strings.TrimSpace(article.SiteName),
+		Canonical:   findCanonicalLink(node, u),
 		Node:        node,
 	}
 	if article.PublishedTime != nil {
@@ -321,6 +506,33 @@ func getArticleMetadataFromNode(node *html.Node, url string) (*Article, error) {
 	return &a, nil
 }
 
+// findCanonicalLink returns the absolute URL of the first <link rel="canonical"> in the document, or "".
+func findCanonicalLink(node *html.Node, base *nurl.URL) string {
+	if node.Type == html.ElementNode && node.Data == "link" {
+		rel, href := "", ""
+		for _, attr := range node.Attr {
+			switch strings.ToLower(attr.Key) {
+			case "rel":
+				rel = strings.ToLower(attr.Val)
+			case "href":
+				href = strings.TrimSpace(attr.Val)
+			}
+		}
+		if rel == "canonical" && href != "" {
+			ref, err := base.Parse(href)
+			if err == nil && (ref.Scheme == "http" || ref.Scheme == "https") {
+				return ref.String()
+			}
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if link := findCanonicalLink(child, base); link != "" {
+			return link
+		}
+	}
+	return ""
+}
+
 func getArticleMetadataFromReader(r io.Reader, url string) (*Article, error) {
 	node, err := html.Parse(r)
 	if err != nil {
@@ -338,36 +550,48 @@ func cleanFilename(s string) string {
 	}
 }
 
-// ReccordToClipping
-// Convert a CSV record to a Clippping and write it to the outputDir
-// Also uses the clipping to create (cleaned) filename
-// Pocket does not always get titles correct and processing can generate a better title.
-func RecordToClipping(r ContentRetriever, outputDir string, record []string, markRead bool, clippingTags []string) (*Clipping, error) {
-	p, err := RecordToPage(record, markRead, clippingTags)
-	if err != nil {
-		log.Fatalf("Error converting record to page: %v", err)
-	}
-
+// PageToClipping
+// Retrieve the page content and convert it to a Clipping, nothing is written.
+// The page is retrieved from its URL as saved, only the source of the clipping is cleaned.
+// If the page has stored HTML that is converted instead, without retrieving anything.
+func PageToClipping(r ContentRetriever, p *Page) (*Clipping, error) {
 	c := NewClipping(p, nil)
-	article, err := ExtractArticleFromContent(r, c.Metadata.Source)
-	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve page %v", err)
+	var article *Article
+	var err error
+	if p.HTML != "" {
+		article, err = ExtractArticleFromHTML([]byte(p.HTML), p.Url)
 	} else {
-		if article != nil {
-			c.Decorate(article)
-		}
+		article, err = ExtractArticleFromContent(r, p.Url)
 	}
-
-	outputFile := filepath.Join(outputDir, cleanFilename(fmt.Sprintf("%s.md", c.Metadata.Title)))
-	file, err := os.Create(outputFile)
 	if err != nil {
-		return nil, fmt.Errorf("error creating file %s: %v", outputFile, err)
+		return nil, fmt.Errorf("unable to retrieve page %v", err)
 	}
-	defer file.Close()
-
-	err = c.Write(file)
-	if err != nil {
-		return nil, fmt.Errorf("error writing clipping to file %s: %v", outputFile, err)
+	if article != nil {
+		c.Decorate(article)
+		c.Article = article
 	}
 	return c, nil
 }
+
+// Filename returns the (cleaned) markdown filename for the clipping, based on its title.
+func (c *Clipping) Filename() string {
+	return cleanFilename(fmt.Sprintf("%s.md", c.Metadata.Title))
+}
+
+// Path returns the path of the clipping relative to the output directory, its folder and filename.
+func (c *Clipping) Path() string {
+	return filepath.Join(cleanFolder(c.Folder), c.Filename())
+}
+
+// cleanFolder makes each level of a / separated folder a clean filename, so it can't escape the output directory.
+func cleanFolder(folder string) string {
+	levels := []string{}
+	for _, level := range strings.Split(folder, "/") {
+		level = strings.TrimSpace(level)
+		if level == "" || level == "." || level == ".." {
+			continue
+		}
+		levels = append(levels, cleanFilename(level))
+	}
+	return filepath.Join(levels...)
+}
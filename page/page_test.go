@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -42,6 +43,19 @@ func (t *testContentDownloader) Get(url string) ([]byte, string, error) {
 	return content, "text/html", nil
 }
 
+// testResourceDownloader also retrieves resources, whatever their content type.
+type testResourceDownloader struct {
+	testContentDownloader
+	resources map[string][]byte
+}
+
+func (t *testResourceDownloader) GetResource(url string) ([]byte, string, error) {
+	if content, ok := t.resources[url]; ok {
+		return content, "", nil
+	}
+	return nil, "", fmt.Errorf("%d : Not Found", http.StatusNotFound)
+}
+
 var _ = Describe("PageTest", Ordered, func() {
 
 	Context("PageTest", func() {
@@ -76,6 +90,12 @@ var _ = Describe("PageTest", Ordered, func() {
 			Expect(page.Read).To(BeTrue(), "Expected read status to be false, got %v", page.Read)
 		})
 
+		It("Should create a page struct without empty tags", func() {
+			page, err := RecordToPage([]string{"Test Title", "http://example.com", "1746041473", "", "unread"}, false, []string{"clippings"})
+			Expect(err).To(BeNil(), "Failed to create page from record")
+			Expect(page.Tags).To(Equal([]string{"clippings"}), "Expected tags ['clippings'], got %v", page.Tags)
+		})
+
 		It("Should write page to string", func() {
 			page := Page{
 				Title:     "Test Title",
@@ -265,6 +285,129 @@ This is a test paragraph.
 		Expect(c.Metadata.Published).To(Equal("original"))
 	})
 
+	It("Should use the canonical link as the source", func() {
+		newstack := "https://thenewstack.io/why-kubernetes-needs-to-be-dumbed-down-for-devops/"
+		r := &testContentDownloader{
+			returnCodes: map[string][]byte{
+				newstack: sampleHTTML,
+			},
+		}
+		article, err := ExtractArticleFromContent(r, newstack)
+		Expect(err).To(BeNil())
+		Expect(article.Canonical).To(Equal("https://aws.amazon.com/blogs/opensource/using-istio-traffic-management-to-enhance-user-experience/"))
+
+		// only followed for the same site
+		c := NewClipping(&Page{Url: "https://aws.amazon.com/blogs/opensource/using-istio-traffic-management-to-enhance-user-experience/?utm_source=pocket"}, nil)
+		Expect(c.Metadata.Source).To(Equal("https://aws.amazon.com/blogs/opensource/using-istio-traffic-management-to-enhance-user-experience/"))
+		c.Decorate(&Article{Canonical: "https://www.aws.amazon.com/istio"})
+		Expect(c.Metadata.Source).To(Equal("https://www.aws.amazon.com/istio"))
+		c.Decorate(&Article{Canonical: "https://example.com/elsewhere"})
+		Expect(c.Metadata.Source).To(Equal("https://www.aws.amazon.com/istio"))
+	})
+
+	It("Should set the typed properties", func() {
+		c := NewClipping(&Page{Url: "https://www.hbr.org/ai-ceos", TimeAdded: 1633036800, Read: true}, nil)
+		Expect(c.Metadata.Created).To(Equal(time.Unix(1633036800, 0).Format("2006-01-02T15:04:05")))
+		Expect(c.Metadata.Status).To(Equal(StatusRead))
+		Expect(c.Metadata.Domain).To(Equal("hbr.org"))
+		Expect(c.Metadata.Site).To(Equal("hbr.org"))
+		c.Decorate(&Article{Canonical: "https://hbr.org/ai-ceos", Text: strings.Repeat("word ", 401), SiteName: "Harvard Business Review"})
+		Expect(c.Metadata.Domain).To(Equal("hbr.org"))
+		Expect(c.Metadata.Site).To(Equal("Harvard Business Review"))
+		Expect(c.Metadata.WordCount).To(Equal(401))
+		Expect(c.Metadata.ReadingTime).To(Equal(3))
+		Expect(NewClipping(&Page{}, nil).Metadata.Status).To(Equal(StatusUnread))
+	})
+
+	It("Should merge tags", func() {
+		Expect(MergeTags([]string{"clippings", "ai"}, []string{"AI", "", "ceo"})).To(Equal([]string{"clippings", "ai", "ceo"}))
+	})
+
+	It("Should read a clipping containing horizontal rules", func() {
+		clipping, err := ReadClipping(bytes.NewReader([]byte("---\ntitle: Test\n---\nabove\n---\nbelow\n")))
+		Expect(err).To(BeNil())
+		Expect(clipping.Metadata.Title).To(Equal("Test"))
+		Expect(string(clipping.MarkdownContent)).To(Equal("above\n---\nbelow\n"))
+	})
+
+	It("Should add highlights as callouts", func() {
+		p := Page{Title: "Test", Url: "http://example.com", Highlights: []Highlight{
+			{Quote: "a test paragraph", CreatedAt: 1633036800},
+			{Quote: "first line\nsecond line", CreatedAt: 1633036900},
+		}}
+		c := NewClipping(&p, []byte("# Test Title\nThis is a test paragraph.\n"))
+		c.AddHighlights(HighlightsCallout, true)
+		Expect(c.Metadata.Highlights).To(Equal(2))
+		md := string(c.MarkdownContent)
+		Expect(md).To(ContainSubstring("This is ==a test paragraph==."))
+		Expect(md).To(ContainSubstring("## Highlights\n\n> [!quote] "))
+		Expect(md).To(ContainSubstring("> first line\n> second line\n"))
+		Expect(string(c.Metadata.YamlBytes())).To(ContainSubstring("highlights: 2"))
+	})
+
+	It("Should only mark highlights in the text", func() {
+		p := Page{Title: "Test", Url: "http://example.com", Highlights: []Highlight{{Quote: "service mesh", CreatedAt: 1633036800}, {Quote: "sidecar"}}}
+		content := "![a service mesh](https://example.com/service mesh.png) [mesh](https://example.com/?q=service mesh)\n" +
+			"```\nservice mesh\n```\nUse `sidecar` to see the service mesh, <a title=\"sidecar\">or</a> a sidecar.\n"
+		c := NewClipping(&p, []byte(content))
+		c.AddHighlights(HighlightsCallout, true)
+		Expect(string(c.MarkdownContent)).To(HavePrefix("![a service mesh](https://example.com/service mesh.png) [mesh](https://example.com/?q=service mesh)\n" +
+			"```\nservice mesh\n```\nUse `sidecar` to see the ==service mesh==, <a title=\"sidecar\">or</a> a ==sidecar==.\n"))
+	})
+
+	It("Should add highlights as blockquotes", func() {
+		p := Page{Title: "Test", Url: "http://example.com", Highlights: []Highlight{{Quote: "a test paragraph", CreatedAt: 1633036800}}}
+		c := NewClipping(&p, []byte("This is a test paragraph.\n"))
+		c.AddHighlights(HighlightsQuote, false)
+		md := string(c.MarkdownContent)
+		Expect(md).To(HavePrefix("This is a test paragraph.\n\n## Highlights\n\n> a test paragraph\n>\n> *"))
+		Expect(md).NotTo(ContainSubstring("[!quote]"))
+	})
+
+	It("Should not add highlights when there are none", func() {
+		c := NewClipping(&Page{Title: "Test"}, []byte("content"))
+		c.AddHighlights(HighlightsCallout, true)
+		Expect(string(c.MarkdownContent)).To(Equal("content"))
+		Expect(string(c.Metadata.YamlBytes())).NotTo(ContainSubstring("highlights"))
+	})
+
+	It("Should put clippings in their folder", func() {
+		c := NewClipping(&Page{Title: "Test", Folder: "Photography"}, nil)
+		Expect(c.Path()).To(Equal(filepath.Join("Photography", "Test.md")))
+		c.Folder = "../Reading/ Tech /"
+		Expect(c.Path()).To(Equal(filepath.Join("Reading", "Tech", "Test.md")))
+		c.Folder = ""
+		Expect(c.Path()).To(Equal("Test.md"))
+	})
+
+	It("Should convert stored HTML without retrieving the page", func() {
+		r := &testContentDownloader{} // every URL is not found
+		p := &Page{
+			Title:   "http://example.com/stored",
+			Url:     "http://example.com/stored",
+			Starred: true,
+			HTML:    string(sampleHTTML),
+		}
+		c, err := PageToClipping(r, p)
+		Expect(err).To(BeNil())
+		Expect(c.Metadata.Title).To(Equal("Using Istio Traffic Management on Amazon EKS to Enhance User Experience | Amazon Web Services"))
+		Expect(c.Metadata.Starred).To(BeTrue())
+		Expect(c.MarkdownContent).NotTo(BeEmpty())
+
+		p.HTML = ""
+		_, err = PageToClipping(r, p)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Should retrieve the page as saved, cleaning only the source", func() {
+		saved := "http://example.com/stored?utm_source=pocket&b=2&a=1"
+		r := &testContentDownloader{returnCodes: map[string][]byte{saved: sampleHTTML}}
+		c, err := PageToClipping(r, &Page{Title: saved, Url: saved})
+		Expect(err).To(BeNil())
+		Expect(c.Metadata.Source).To(Equal("http://example.com/stored?a=1&b=2"))
+		Expect(c.MarkdownContent).NotTo(BeEmpty())
+	})
+
 	It("Should clean filenames", func() {
 		orig := "akka/stream-design.rst at wip-stream-design-docs · akka/akka · GitHub"
 		s := cleanFilename(orig)
@@ -329,4 +472,33 @@ This is a test paragraph.
 		Expect(article.Title).To(Equal("Using Istio Traffic Management on Amazon EKS to Enhance User Experience | Amazon Web Services"), "Expected article title to match")
 	})
 
+	It("Should snapshot the article with images inlined and scripts stripped", func() {
+		png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+		r := &testResourceDownloader{resources: map[string][]byte{"https://example.com/images/a.png": png}}
+		c := NewClipping(&Page{Title: "Snapshot", Url: "https://example.com/posts/a"}, nil)
+		_, err := c.Snapshot(r)
+		Expect(err).NotTo(BeNil(), "there is no article")
+
+		c.Article = &Article{Content: `<div><p onclick="steal()">Text <a href="../b">link</a> <a href="javascript:steal()">bad</a></p>` +
+			`<a href=" java&#9;script:steal()">bad</a><a href="&#1;javascript:steal()">bad</a><form action="JavaScript:steal()"><button formaction="https://evil.example.com/steal">go</button></form>` +
+			`<svg><a xlink:href="javascript:steal()"><text>bad</text></a></svg><iframe srcdoc="&lt;script&gt;steal()&lt;/script&gt;"></iframe><p srcdoc="steal()">x</p>` +
+			`<script>steal()</script><img src="/images/a.png" srcset="/images/a-2x.png 2x"><img src="https://cdn.example.com/missing.jpg"></div>`}
+		snapshot, err := c.Snapshot(r)
+		Expect(err).To(BeNil())
+		html := string(snapshot)
+		Expect(html).To(ContainSubstring("<title>Snapshot</title>"))
+		Expect(html).To(ContainSubstring(`<img src="data:image/png;base64,`))
+		Expect(html).To(ContainSubstring(`<img src="https://cdn.example.com/missing.jpg"/>`))
+		Expect(html).To(ContainSubstring(`<a href="https://example.com/b">link</a>`))
+		Expect(html).NotTo(ContainSubstring("steal"))
+		Expect(html).NotTo(ContainSubstring("formaction"))
+		Expect(html).NotTo(ContainSubstring("srcdoc"))
+		Expect(html).NotTo(ContainSubstring("srcset"))
+
+		// without a ResourceRetriever images stay linked
+		snapshot, err = c.Snapshot(&testContentDownloader{})
+		Expect(err).To(BeNil())
+		Expect(string(snapshot)).To(ContainSubstring(`<img src="https://example.com/images/a.png"/>`))
+	})
+
 })
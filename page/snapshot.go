@@ -0,0 +1,180 @@
+package page
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	nurl "net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ResourceRetriever is implemented by ContentRetrievers which can also retrieve the resources of a page,
+// such as images, whatever their content type.
+type ResourceRetriever interface {
+	GetResource(url string) ([]byte, string, error)
+}
+
+// maxImageSize is the largest image inlined into a snapshot, larger images are left linked.
+const maxImageSize = 10 << 20
+
+// strippedElements are removed from snapshots, along with their content.
+var strippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Link:     true,
+	atom.Base:     true,
+}
+
+// strippedAttrs are removed from the elements of snapshots, they can run scripts or load other documents.
+var strippedAttrs = map[string]bool{
+	"formaction": true,
+	"xlink:href": true,
+	"srcdoc":     true,
+}
+
+// urlAttrs are the attributes holding a URL, which are removed if it is a javascript: URL.
+var urlAttrs = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"action": true,
+	"data":   true,
+	"poster": true,
+}
+
+var snapshotTemplate = template.Must(template.New("snapshot").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>body { max-width: 42em; margin: 2em auto; padding: 0 1em; font-family: Georgia, serif; line-height: 1.6; } img { max-width: 100%; height: auto; }</style>
+</head>
+<body>
+<article>
+<h1>{{.Title}}</h1>
+<p><a href="{{.Source}}">{{.Source}}</a></p>
+{{.Content}}
+</article>
+</body>
+</html>
+`))
+
+// Snapshot returns a self-contained HTML page of the article the clipping was converted from: the readability
+// output with scripts stripped and, if r is a ResourceRetriever, images inlined as data URIs.
+func (c *Clipping) Snapshot(r ContentRetriever) ([]byte, error) {
+	if c.Article == nil {
+		return nil, fmt.Errorf("no article to snapshot for %s", c.Metadata.Source)
+	}
+	base, err := nurl.Parse(c.Metadata.Source)
+	if err != nil {
+		return nil, fmt.Errorf("error unnable to parse URL: %s - %v", c.Metadata.Source, err)
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(c.Article.Content), body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing article HTML: %w", err)
+	}
+	resources, _ := r.(ResourceRetriever)
+	var content bytes.Buffer
+	for _, n := range nodes {
+		cleanSnapshotNode(n, base, resources)
+		if err := html.Render(&content, n); err != nil {
+			return nil, fmt.Errorf("error rendering article HTML: %w", err)
+		}
+	}
+
+	var b bytes.Buffer
+	err = snapshotTemplate.Execute(&b, map[string]any{
+		"Title":   c.Metadata.Title,
+		"Source":  c.Metadata.Source,
+		"Content": template.HTML(content.String()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing snapshot: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// cleanSnapshotNode strips scripts, event handlers and javascript: URLs below n and inlines its images.
+func cleanSnapshotNode(n *html.Node, base *nurl.URL, r ResourceRetriever) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode && strippedElements[child.DataAtom] {
+			n.RemoveChild(child)
+		} else {
+			cleanSnapshotNode(child, base, r)
+		}
+		child = next
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + key // xlink:href in SVG
+		}
+		switch {
+		case strings.HasPrefix(key, "on") || strippedAttrs[key]:
+			continue
+		case urlAttrs[key] && isScriptURL(a.Val):
+			continue
+		case n.DataAtom == atom.Img && (key == "srcset" || key == "sizes" || key == "loading"):
+			continue // the inlined src is used instead
+		case n.DataAtom == atom.Img && key == "src":
+			a.Val = inlineImage(a.Val, base, r)
+		case key == "href":
+			if ref, err := base.Parse(a.Val); err == nil {
+				a.Val = ref.String()
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
+// isScriptURL reports whether u is a javascript: URL as a browser reads it, ignoring leading spaces and control
+// characters, and tabs and newlines anywhere.
+func isScriptURL(u string) bool {
+	u = strings.TrimLeftFunc(u, func(r rune) bool { return r <= ' ' })
+	u = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(u)
+	return strings.HasPrefix(strings.ToLower(u), "javascript:")
+}
+
+// inlineImage returns the image at src as a data URI, or its absolute URL if it can't be retrieved.
+func inlineImage(src string, base *nurl.URL, r ResourceRetriever) string {
+	if strings.HasPrefix(src, "data:") {
+		return src
+	}
+	ref, err := base.Parse(src)
+	if err != nil {
+		return src
+	}
+	if r == nil {
+		return ref.String()
+	}
+	content, contentType, err := r.GetResource(ref.String())
+	if err != nil || len(content) == 0 || len(content) > maxImageSize {
+		return ref.String()
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && strings.HasPrefix(mediaType, "image/") {
+		contentType = mediaType
+	} else {
+		contentType = http.DetectContentType(content)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return ref.String()
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(content)
+}
@@ -0,0 +1,150 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"gopkg.in/yaml.v3"
+)
+
+// Action is what a run would do with the note for a record.
+type Action string
+
+const (
+	ActionCreate    Action = "create"    // no note exists at the path
+	ActionOverwrite Action = "overwrite" // a note already exists at the path, or an earlier record in the run claims it
+	ActionSkip      Action = "skip"      // nothing would be written, see the change error
+)
+
+// Change describes the planned outcome for a single input record.
+type Change struct {
+	Index       int            `json:"index"`
+	Source      string         `json:"source"`
+	Path        string         `json:"path,omitempty"`
+	Action      Action         `json:"action"`
+	Collisions  []string       `json:"collisions,omitempty"` // sources of other records planned for the same path
+	Error       string         `json:"error,omitempty"`
+	Frontmatter map[string]any `json:"frontmatter,omitempty"`
+}
+
+// NewChange creates the change for the record at index. If err is set the record is skipped.
+func NewChange(index int, source string, path string, c *page.Clipping, err error) *Change {
+	e := &Change{
+		Index:  index,
+		Source: source,
+	}
+	if err != nil {
+		e.Action = ActionSkip
+		e.Error = err.Error()
+		return e
+	}
+	e.Path = path
+	// round trip through YAML so the frontmatter keys are exactly those written to the note
+	if uerr := yaml.Unmarshal(c.Metadata.YamlBytes(), &e.Frontmatter); uerr != nil {
+		e.Error = uerr.Error()
+	}
+	return e
+}
+
+// Plan collects changes from concurrent workers, it is safe for concurrent use.
+type Plan struct {
+	mu      sync.Mutex
+	Changes []*Change
+}
+
+func (p *Plan) Add(e *Change) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Changes = append(p.Changes, e)
+}
+
+// Resolve orders the changes by input index and works out the action for each one.
+// exists reports whether a note is already present at a path.
+func (p *Plan) Resolve(exists func(path string) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sort.Slice(p.Changes, func(i, j int) bool { return p.Changes[i].Index < p.Changes[j].Index })
+
+	byPath := map[string][]*Change{}
+	for _, e := range p.Changes {
+		if e.Action == ActionSkip {
+			continue
+		}
+		if len(byPath[e.Path]) > 0 || exists(e.Path) {
+			e.Action = ActionOverwrite
+		} else {
+			e.Action = ActionCreate
+		}
+		byPath[e.Path] = append(byPath[e.Path], e)
+	}
+
+	for _, changes := range byPath {
+		if len(changes) < 2 {
+			continue
+		}
+		for _, e := range changes {
+			for _, other := range changes {
+				if other != e {
+					e.Collisions = append(e.Collisions, other.Source)
+				}
+			}
+		}
+	}
+}
+
+// Count returns the number of changes with the given action.
+func (p *Plan) Count(a Action) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return countIn(p.Changes, a)
+}
+
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p.Changes)
+}
+
+func (p *Plan) WriteText(w io.Writer) error {
+	for _, e := range p.Changes {
+		if _, err := fmt.Fprintf(w, "%-9s %s\n", e.Action, e.Source); err != nil {
+			return err
+		}
+		if e.Path != "" {
+			fmt.Fprintf(w, "          -> %s\n", e.Path)
+		}
+		if e.Error != "" {
+			fmt.Fprintf(w, "          error: %s\n", e.Error)
+		}
+		for _, c := range e.Collisions {
+			fmt.Fprintf(w, "          collides with: %s\n", c)
+		}
+		if e.Frontmatter != nil {
+			b, err := yaml.Marshal(e.Frontmatter)
+			if err != nil {
+				return err
+			}
+			for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+				fmt.Fprintf(w, "          | %s\n", line)
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d to create, %d to overwrite, %d to skip\n", countIn(p.Changes, ActionCreate), countIn(p.Changes, ActionOverwrite), countIn(p.Changes, ActionSkip))
+	return err
+}
+
+func countIn(changes []*Change, a Action) int {
+	n := 0
+	for _, e := range changes {
+		if e.Action == a {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,90 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPlan(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "plan suite")
+}
+
+func testClipping(title string, url string) *page.Clipping {
+	return page.NewClipping(&page.Page{
+		Title:     title,
+		Url:       url,
+		TimeAdded: 1633036800,
+		Tags:      []string{"clippings"},
+	}, nil)
+}
+
+var _ = Describe("PlanTest", func() {
+
+	It("Should record the frontmatter that would be written", func() {
+		e := NewChange(0, "http://example.com", "archive/Test.md", testClipping("Test", "http://example.com"), nil)
+		Expect(e.Error).To(BeEmpty())
+		Expect(e.Frontmatter).To(HaveKeyWithValue("title", "Test"))
+		Expect(e.Frontmatter).To(HaveKeyWithValue("source", "http://example.com"))
+		Expect(e.Frontmatter).To(HaveKey("tags"))
+	})
+
+	It("Should skip records that failed", func() {
+		e := NewChange(0, "http://example.com", "", nil, errors.New("404 : Not Found"))
+		Expect(e.Action).To(Equal(ActionSkip))
+		Expect(e.Error).To(Equal("404 : Not Found"))
+		Expect(e.Frontmatter).To(BeNil())
+	})
+
+	It("Should resolve create, overwrite and collisions", func() {
+		p := &Plan{}
+		// added out of order, as the workers would
+		p.Add(NewChange(2, "http://c.com", "archive/Same.md", testClipping("Same", "http://c.com"), nil))
+		p.Add(NewChange(0, "http://a.com", "archive/A.md", testClipping("A", "http://a.com"), nil))
+		p.Add(NewChange(1, "http://b.com", "archive/Same.md", testClipping("Same", "http://b.com"), nil))
+		p.Add(NewChange(3, "http://d.com", "archive/Existing.md", testClipping("Existing", "http://d.com"), nil))
+		p.Add(NewChange(4, "http://e.com", "", nil, errors.New("failed")))
+
+		p.Resolve(func(path string) bool { return path == "archive/Existing.md" })
+
+		Expect(p.Changes[0].Source).To(Equal("http://a.com"))
+		Expect(p.Changes[0].Action).To(Equal(ActionCreate))
+		Expect(p.Changes[0].Collisions).To(BeEmpty())
+		Expect(p.Changes[1].Action).To(Equal(ActionCreate))
+		Expect(p.Changes[1].Collisions).To(Equal([]string{"http://c.com"}))
+		Expect(p.Changes[2].Action).To(Equal(ActionOverwrite))
+		Expect(p.Changes[2].Collisions).To(Equal([]string{"http://b.com"}))
+		Expect(p.Changes[3].Action).To(Equal(ActionOverwrite))
+		Expect(p.Changes[4].Action).To(Equal(ActionSkip))
+
+		Expect(p.Count(ActionCreate)).To(Equal(2))
+		Expect(p.Count(ActionOverwrite)).To(Equal(2))
+		Expect(p.Count(ActionSkip)).To(Equal(1))
+	})
+
+	It("Should write the plan as JSON and text", func() {
+		p := &Plan{}
+		p.Add(NewChange(0, "http://a.com", "archive/A.md", testClipping("A", "http://a.com"), nil))
+		p.Resolve(func(string) bool { return false })
+
+		var b bytes.Buffer
+		Expect(p.WriteJSON(&b)).To(Succeed())
+		var changes []map[string]any
+		Expect(json.Unmarshal(b.Bytes(), &changes)).To(Succeed())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0]).To(HaveKeyWithValue("action", "create"))
+		Expect(changes[0]).To(HaveKeyWithValue("path", "archive/A.md"))
+
+		b.Reset()
+		Expect(p.WriteText(&b)).To(Succeed())
+		Expect(b.String()).To(ContainSubstring("create    http://a.com"))
+		Expect(b.String()).To(ContainSubstring("| title: A"))
+		Expect(b.String()).To(ContainSubstring("1 to create, 0 to overwrite, 0 to skip"))
+	})
+})
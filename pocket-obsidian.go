@@ -5,12 +5,32 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/fergalsomers/pocket-obsidian/canvas"
+	"github.com/fergalsomers/pocket-obsidian/crosslink"
 	"github.com/fergalsomers/pocket-obsidian/csv"
+	"github.com/fergalsomers/pocket-obsidian/daily"
+	"github.com/fergalsomers/pocket-obsidian/dashboard"
+	"github.com/fergalsomers/pocket-obsidian/dedupe"
+	"github.com/fergalsomers/pocket-obsidian/filter"
+	"github.com/fergalsomers/pocket-obsidian/moc"
 	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/plan"
+	"github.com/fergalsomers/pocket-obsidian/sink"
+	"github.com/fergalsomers/pocket-obsidian/site"
+	"github.com/fergalsomers/pocket-obsidian/snapshot"
+	"github.com/fergalsomers/pocket-obsidian/source"
+	"github.com/fergalsomers/pocket-obsidian/tags"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"github.com/fergalsomers/pocket-obsidian/warc"
 
 	flag "github.com/spf13/pflag"
 	"github.com/vbauerster/mpb/v8"
@@ -20,15 +40,57 @@ import (
 const (
 	defaultOutpurDir         = "archive"
 	defaultFailedCSVFilename = "failed.csv"
+	folderModeTag            = "tag"
+	folderModeFolder         = "folder"
 )
 
 var (
 	defaultTags  = []string{"clippings", "pocket"}
-	outputDir    string   // Directory to write output files to, defaults to ./archive
+	outputDir    string   // Directory (or archive, or - for stdout) to write output files to, defaults to ./archive
 	markRead     bool     // If true, mark articles as read in Pocket
 	clippingTags []string // Default tags to add to all csv entries, defaults to clippings (per obsidian webclipper plugin)
-	inputFile    string   // Arg 0 - the input CSV file containing Pocket records
+	inputs       []string // Args - input Pocket exports, URLs or - to read URLs from stdin
 	failedCSV    string
+	dryRun       bool   // If true, fetch and convert but write nothing, report the planned changes instead
+	noFetch      bool   // If true with dry-run, don't retrieve the pages, plan from the records alone
+	dryRunFormat string // text or json
+	recordFilter filter.Filter
+	dedupeURLs   bool // If true, skip articles already clipped, in this run or in the output directory
+	tagRules     tags.Normaliser
+	highlightsAs string          // render highlights as a quote or callout
+	markQuotes   bool            // If true, also mark highlighted passages with ==text==
+	inputFormat  string          // format of the input files, see source.Formats
+	folderMode   string          // map imported folders to a tag or an output sub-directory
+	snapshotDir  string          // directory of saved pages to use instead of retrieving them
+	warcOut      string          // WARC file to record the retrieved pages to
+	warcReplay   string          // WARC file to replay the pages from instead of retrieving them
+	htmlSnapshot bool            // If true, also save a self-contained HTML snapshot of each article
+	attachDir    string          // folder of the output directory for snapshots, / separated
+	mocDir       string          // folder of the output directory for maps of content, "" for none
+	dailyDir     string          // folder of the output directory for daily notes, "" for none
+	dailyFormat  string          // moment.js date format of the daily notes' names
+	dailyTmpl    string          // template for new daily notes, "" for none
+	canvasFile   string          // canvas of the output directory to generate, "" for none
+	canvasGroup  string          // group the canvas by tag or domain
+	canvasUnread bool            // If true, only put unread clippings on the canvas
+	dashDir      string          // folder of the output directory for dashboards, "" for none
+	propTypes    bool            // If true, declare the property types in an Obsidian vault's types.json
+	written      notes           // the clippings written this run to an archive or stdout
+	siteDir      string          // folder of the output directory for site notes, "" for none
+	linkNotes    bool            // If true, rewrite links between clippings as links to their notes
+	useDaily     bool            // If true, add the clippings to the daily notes where the vault's settings put them
+	settings     *vault.Settings // the Obsidian vault the output directory is in, nil if it isn't in one
+	notesDir     string          // folder of the output directory for the clippings, / separated, "" for the output directory
+	watchDir     string          // inbox folder to watch for inputs, "" to convert the arguments
+	watchPoll    bool            // If true, scan the inbox instead of relying on filesystem notifications
+)
+
+// Flags validated by parseFlags into recordFilter and tagRules.
+var (
+	addedAfter  string
+	addedBefore string
+	titleRegex  string
+	tagMap      string
 )
 
 func init() {
@@ -39,49 +101,239 @@ func init() {
 	}
 	currentDir := filepath.Join(path, defaultOutpurDir)
 	defaultCSVFile := filepath.Join(path, defaultFailedCSVFilename)
-	flag.StringVarP(&outputDir, "output-dir", "o", currentDir, "Directory to write output files to defaults to ./archive")
+	flag.StringVarP(&outputDir, "output-dir", "o", currentDir, "Directory to write output files to defaults to ./archive. A .zip, .tar, .tar.gz or .tgz file writes an archive, - writes the notes to stdout")
 	flag.BoolVarP(&markRead, "read", "r", false, "Mark articles as read in Pocket")
 	flag.StringArrayVarP(&clippingTags, "tags", "t", defaultTags, "Default tags to add to all csv entries, defaults to clippings (per obsidian webclipper plugin)")
 	flag.StringVarP(&failedCSV, "fail-csv", "f", defaultCSVFile, "Default tags to write failed entries to")
+	flag.BoolVarP(&dryRun, "dry-run", "n", false, "Don't write anything, print the notes that would be created, overwritten or skipped")
+	flag.BoolVar(&noFetch, "no-fetch", false, "With --dry-run, plan from the input records without retrieving the pages")
+	flag.StringVar(&dryRunFormat, "dry-run-format", "text", "Format of the --dry-run report written to stdout, text or json")
+	flag.StringArrayVar(&recordFilter.IncludeTags, "include-tag", nil, "Only process records with at least one of these Pocket tags")
+	flag.StringArrayVar(&recordFilter.ExcludeTags, "exclude-tag", nil, "Skip records with any of these Pocket tags")
+	flag.BoolVar(&recordFilter.UnreadOnly, "unread-only", false, "Only process records that are unread in Pocket")
+	flag.StringVar(&addedAfter, "added-after", "", "Only process records added on or after this date (YYYY-MM-DD)")
+	flag.StringVar(&addedBefore, "added-before", "", "Only process records added before this date (YYYY-MM-DD)")
+	flag.StringArrayVar(&recordFilter.AllowDomains, "allow-domain", nil, "Only process records from these domains (and their sub-domains)")
+	flag.StringArrayVar(&recordFilter.DenyDomains, "deny-domain", nil, "Skip records from these domains (and their sub-domains)")
+	flag.StringVar(&titleRegex, "title-regex", "", "Only process records whose title matches this regular expression")
+	flag.BoolVar(&dedupeURLs, "dedupe", true, "Skip articles already clipped, in the input or the output directory, merging their tags into the existing note")
+	flag.BoolVar(&tagRules.Lowercase, "tag-lowercase", false, "Lower case all tags")
+	flag.BoolVar(&tagRules.Kebab, "tag-kebab", false, "Convert all tags to kebab-case")
+	flag.StringVar(&tagMap, "tag-map", "", "YAML file mapping tags to new names, e.g. 'ai: topic/ai'. Map a tag to \"\" to drop it")
+	flag.StringVar(&highlightsAs, "highlights", page.HighlightsCallout, "Render Pocket highlights as a quote or callout")
+	flag.BoolVar(&markQuotes, "mark-highlights", false, "Also mark highlighted passages in the article with ==text==")
+	flag.StringVar(&inputFormat, "input-format", source.Auto, "Format of the input files: "+strings.Join(source.Formats(), ", ")+". auto detects it from the content")
+	flag.StringVar(&folderMode, "folder-mode", folderModeTag, "Map Instapaper and bookmark folders to a tag or to a folder in the output directory")
+	flag.StringVar(&snapshotDir, "snapshots", "", "Directory of saved pages (SingleFile, Save Page As) to convert instead of retrieving them, indexed by "+snapshot.ManifestName+" or the URL saved in each page")
+	flag.StringVar(&warcOut, "warc", "", "Record every page retrieved to this WARC file, compressed if it ends in .gz")
+	flag.StringVar(&warcReplay, "warc-replay", "", "Replay the pages from this WARC file (such as one written by --warc) instead of retrieving them")
+	flag.BoolVar(&htmlSnapshot, "html-snapshot", false, "Also save a self-contained HTML snapshot of each article (images inlined, scripts stripped) to the attachments folder, linked from the note's snapshot property")
+	flag.StringVar(&attachDir, "attachments", "attachments", "Folder of the output directory for HTML snapshots")
+	flag.StringVar(&mocDir, "moc", "", "Generate maps of content, index notes per tag, domain and month, in this folder of the output directory (e.g. MOCs)")
+	flag.StringVar(&dailyDir, "daily-notes", "", "Add the clippings to a Saved section of the daily note for the day they were saved, in this folder of the output directory (e.g. Daily)")
+	flag.StringVar(&dailyFormat, "daily-format", daily.DefaultFormat, "Date format of the daily notes' names, as in Obsidian's daily notes settings")
+	flag.StringVar(&dailyTmpl, "daily-template", "", "Template for new daily notes, a file or a note in the output directory, supporting {{date}}, {{time}} and {{title}}")
+	flag.StringVar(&siteDir, "sites", "", "Generate a note per site, with its description and clippings, in this folder of the output directory (e.g. Sites) and link each clipping's site property to it")
+	flag.BoolVar(&linkNotes, "link-clippings", false, "Rewrite links to articles clipped in the output directory as links to their notes, in every note there with a source property")
+	flag.BoolVar(&useDaily, "daily", false, "Add the clippings to the daily notes in the folder, format and template of the vault's daily notes settings")
+	flag.StringVar(&canvasFile, "canvas", "", "Generate an Obsidian canvas of the clippings in the output directory at this path of it (e.g. Reading.canvas)")
+	flag.StringVar(&canvasGroup, "canvas-group", canvas.GroupTag, "Group the clippings on the canvas by tag or domain")
+	flag.BoolVar(&canvasUnread, "canvas-unread", false, "Only put unread clippings on the canvas")
+	flag.StringVar(&dashDir, "dashboards", "", "Generate Bases and Dataview dashboards of unread clippings by domain and recently saved clippings in this folder of the output directory (e.g. Dashboards)")
+	flag.BoolVar(&propTypes, "property-types", true, "Declare the types of the clipping properties in "+vault.TypesPath+" when the output directory is an Obsidian vault, or with --dashboards")
+	flag.StringVar(&watchDir, "watch", "", "Watch this inbox folder, clipping each export, bookmarks file or .txt list of URLs dropped into it and then moving it to the inbox's done or failed folder")
+	flag.BoolVar(&watchPoll, "watch-poll", false, "Scan the --watch folder every few seconds instead of relying on filesystem notifications, e.g. on a network drive")
 	flag.Usage = func() {
-		fmt.Fprint(os.Stderr, "Usage of pocket-obsidian [input-csv-file]\n")
+		fmt.Fprint(os.Stderr, "Usage of pocket-obsidian [pocket-export | url | -]...\n   or: pocket-obsidian search [flags] query, see pocket-obsidian search --help\n   or: pocket-obsidian serve [flags], see pocket-obsidian serve --help\n")
 		flag.PrintDefaults()
 	}
 
 	flag.ErrHelp = errors.New("pocket-obsidian: Convert Mozilla Pocket exported CSV to Obsidian Markdown. See https://github.com/fergalsomers/pocket-obsidian")
+}
 
+// parseFlags parses and validates the command line, exiting on an error. It isn't done in init so subcommands can parse their own.
+func parseFlags() {
+	var err error
 	flag.Parse()
 	args := flag.Args()
-	if len(args) != 1 {
-		fmt.Fprint(os.Stderr, "Error issing argument [input-csv-file]\n\n")
+	if len(args) == 0 && watchDir == "" {
+		fmt.Fprint(os.Stderr, "Error missing argument [pocket-export | url | -]\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	inputs = args
+
+	if addedAfter != "" {
+		if recordFilter.AddedAfter, err = filter.ParseDate(addedAfter); err != nil {
+			fmt.Fprintf(os.Stderr, "Error --added-after: %v\n\n", err)
+			os.Exit(1)
+		}
+	}
+	if addedBefore != "" {
+		if recordFilter.AddedBefore, err = filter.ParseDate(addedBefore); err != nil {
+			fmt.Fprintf(os.Stderr, "Error --added-before: %v\n\n", err)
+			os.Exit(1)
+		}
+	}
+	if titleRegex != "" {
+		if recordFilter.Title, err = regexp.Compile(titleRegex); err != nil {
+			fmt.Fprintf(os.Stderr, "Error --title-regex: %v\n\n", err)
+			os.Exit(1)
+		}
+	}
+	if tagMap != "" {
+		if tagRules.Mapping, err = tags.ReadMapping(tagMap); err != nil {
+			fmt.Fprintf(os.Stderr, "Error --tag-map: %v\n\n", err)
+			os.Exit(1)
+		}
+	}
+	if highlightsAs != page.HighlightsQuote && highlightsAs != page.HighlightsCallout {
+		fmt.Fprintf(os.Stderr, "Error unknown --highlights %s, expected quote or callout\n\n", highlightsAs)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if !slices.Contains(source.Formats(), inputFormat) {
+		fmt.Fprintf(os.Stderr, "Error unknown --input-format %s, expected one of %s\n\n", inputFormat, strings.Join(source.Formats(), ", "))
+		flag.Usage()
+		os.Exit(1)
+	}
+	if folderMode != folderModeTag && folderMode != folderModeFolder {
+		fmt.Fprintf(os.Stderr, "Error unknown --folder-mode %s, expected tag or folder\n\n", folderMode)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if canvasGroup != canvas.GroupTag && canvasGroup != canvas.GroupDomain {
+		fmt.Fprintf(os.Stderr, "Error unknown --canvas-group %s, expected tag or domain\n\n", canvasGroup)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if watchDir != "" && (len(args) > 0 || dryRun || warcOut != "" || !sink.IsDir(outputDir)) {
+		fmt.Fprint(os.Stderr, "Error --watch takes its inputs from the folder, and writes to a directory without --dry-run or --warc\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
-	inputFile = args[0]
+	if dryRunFormat != "text" && dryRunFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Error unknown --dry-run-format %s, expected text or json\n\n", dryRunFormat)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if notesOnly() && (htmlSnapshot || canvasFile != "") {
+		log.Printf("Only the notes are written to stdout, without the HTML snapshots or canvas")
+	}
+}
+
+// notesOnly reports whether the output is the stream of notes on stdout, which can't hold other files.
+func notesOnly() bool {
+	return outputDir == sink.Stdout
+}
+
+type job struct {
+	index int
+	item  *source.Item
 }
 
 type Result struct {
-	Record []string
-	Err    error
+	Item *source.Item
+	Err  error
+}
+
+// notes is a list of notes which is safe for concurrent use.
+type notes struct {
+	mu    sync.Mutex
+	notes []vault.Note
+}
+
+func (n *notes) add(note vault.Note) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notes = append(n.notes, note)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == searchCommand {
+		os.Exit(runSearch(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == serveCommand {
+		os.Exit(runServe(os.Args[2:]))
+	}
+	parseFlags()
+	if watchDir != "" {
+		os.Exit(watchInbox())
+	}
+	if err := convert(inputs); err != nil {
+		log.Fatalf("Error %v", err)
+	}
+}
+
+// convert clips the items of the inputs into the output directory, and generates the notes asked for.
+// Returns an error if the inputs, the vault or the snapshots can't be read or the output can't be written,
+// articles which can't be clipped are written to the failed CSV instead.
+func convert(inputs []string) error {
+	items, failedList, err := readItems(inputs)
+	if err != nil {
+		return fmt.Errorf("reading input: %w", err)
+	}
+	if len(failedList) > 0 {
+		log.Printf("Unable to read %d records", len(failedList))
+	}
+
+	readRecords := len(items) + len(failedList)
+	items = filterItems(items, &recordFilter)
+	filteredRecords := readRecords - len(failedList) - len(items)
+	if filteredRecords > 0 {
+		log.Printf("Filtered out %d of %d records", filteredRecords, readRecords)
+	}
+
+	if err := findVault(); err != nil {
+		return err
+	}
 
-	records, err := csv.ReadCSV(inputFile)
+	var index *dedupe.Index
+	duplicates := 0
+	if dedupeURLs {
+		var inputDuplicates, vaultDuplicates int
+		items, inputDuplicates = dedupe.Items(items)
+		index = dedupe.NewIndex()
+		if sink.IsDir(outputDir) {
+			index, err = dedupe.Load(outputDir)
+		}
+		if err != nil {
+			return fmt.Errorf("reading existing notes: %w", err)
+		}
+		items, vaultDuplicates = dropClipped(items, index)
+		log.Printf("Skipping %d duplicate records and %d records already in %s", inputDuplicates, vaultDuplicates, outputDir)
+		duplicates = inputDuplicates + vaultDuplicates
+	}
+
+	c, closeWARC, err := contentRetriever()
 	if err != nil {
-		log.Fatalf("Error reading CSV file: %v", err)
+		return err
+	}
+	if snapshotDir != "" {
+		snapshots, err := snapshot.Open(snapshotDir, c)
+		if err != nil {
+			closeWARC()
+			return fmt.Errorf("reading snapshots: %w", err)
+		}
+		log.Printf("Found snapshots of %d URLs in %s", snapshots.Len(), snapshotDir)
+		c = snapshots
 	}
 
-	records = records[1:] // lose the header
-	totalRecords := len(records)
-	log.Printf("Read %d records from %s", totalRecords, inputFile)
-	log.Printf("Writing records to %s", outputDir)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		log.Fatalf("Error creating output directory: %v", err)
+	totalRecords := len(items)
+	dryRunPlan := &plan.Plan{}
+	var out sink.Sink
+	if dryRun {
+		log.Printf("Dry run, planning records for %s", outputDir)
+	} else {
+		log.Printf("Writing records to %s", outputDir)
+		if out, err = sink.Open(outputDir); err != nil {
+			closeWARC()
+			return fmt.Errorf("opening output: %w", err)
+		}
 	}
 
 	var wg sync.WaitGroup
-	pc := mpb.New(mpb.WithWidth(80), mpb.WithWaitGroup(&wg))
+	pc := mpb.New(mpb.WithWidth(80), mpb.WithWaitGroup(&wg), mpb.WithOutput(os.Stderr))
 	wg.Add(2)
 	bar := pc.AddBar(int64(totalRecords),
 		mpb.PrependDecorators(
@@ -102,72 +354,739 @@ func main() {
 		),
 	)
 
-	work := make(chan []string)
+	work := make(chan job)
 	results := make(chan Result)
 
 	numWorkers := runtime.NumCPU()
 	log.Printf("Number of processors: %d", numWorkers)
 
 	// Start some workers to process the results
-	c := page.NewContentRetriever()
 	for i := 0; i < numWorkers; i++ {
 		go func() {
 			for {
-				record, ok := <-work
+				j, ok := <-work
 				if !ok {
 					return
 				}
-				_, err := page.RecordToClipping(c, outputDir, record, markRead, clippingTags)
-				results <- Result{Record: record, Err: err}
+				_, err := processItem(c, index, out, dryRunPlan, j)
+				results <- Result{Item: j.item, Err: err}
 			}
 		}()
 	}
 
-	failedList := [][]string{}
-
 	// Start the worker processing the results
 	go func() {
 		defer wg.Done()
 		defer wg.Done()
 		defer close(work)
 		defer close(results)
-		processResults(&failedList, len(records), results, bar, failedBar)
+		duplicates += processResults(&failedList, len(items), results, bar, failedBar)
+		bar.SetTotal(int64(len(items)), true) // complete, even with nothing to process
 
 		failedTotal := int64(len(failedList))
 		failedBar.SetTotal(failedTotal, true)
 
 	}()
 
-	// put recorcs on the work channel
-	for _, record := range records {
-		work <- record
+	// put items on the work channel
+	for i, item := range items {
+		work <- job{index: i, item: item}
 	}
 
 	pc.Wait() // the wg.Done above will cause this to stop blocking.
 
+	log.Printf("Summary: %d read, %d filtered out, %d duplicates, %d processed, %d failed", readRecords, filteredRecords, duplicates, totalRecords, len(failedList))
+
+	if index != nil {
+		if merges := index.Drain(); sink.IsDir(outputDir) {
+			mergeTags(merges)
+		} else if len(merges) > 0 {
+			log.Printf("Not merging the tags of duplicates into %d notes, %s isn't a directory", len(merges), outputDir)
+		}
+	}
+
+	if out != nil && linkNotes && sink.IsDir(outputDir) {
+		linkClippings()
+	}
+
+	// generated notes are built once the clippings, and their merged tags, are written
+	if out != nil && mocDir != "" {
+		writeMOCs(out)
+	}
+	if out != nil && siteDir != "" {
+		writeSites(out, c)
+	}
+	closeWARC() // after the sites' home pages are retrieved
+	if out != nil && (dailyDir != "" || useDaily) {
+		writeDaily(out)
+	}
+	if out != nil && canvasFile != "" && !notesOnly() {
+		writeCanvas(out)
+	}
+	if out != nil && propTypes && (dashDir != "" || settings != nil) && !notesOnly() {
+		writeTypes(out)
+	}
+	if out != nil && dashDir != "" {
+		writeDashboards(out)
+	}
+	if out != nil {
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	}
+
+	if dryRun {
+		if err := writePlan(dryRunPlan); err != nil {
+			return fmt.Errorf("writing dry run report: %w", err)
+		}
+		return nil
+	}
+
 	if len(failedList) > 0 {
 		log.Printf("Failed to retrieve %d entries", len(failedList))
 		err := csv.WriteCSV(failedCSV,
 			[]string{"title", "url", "time_added", "tags", "status", "error"},
 			failedList)
 		if err != nil {
-			log.Fatal("Unable to write failedList %w", err)
+			return fmt.Errorf("writing failed records to %s: %w", failedCSV, err)
+		}
+	}
+	return nil
+}
+
+// contentRetriever returns how pages are retrieved: from the network, recording them with --warc,
+// or replayed with --warc-replay. The returned func must be called once all pages have been retrieved.
+func contentRetriever() (page.ContentRetriever, func(), error) {
+	switch {
+	case warcReplay != "":
+		archive, err := warc.Open(warcReplay)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading WARC file: %w", err)
+		}
+		log.Printf("Replaying %d pages from %s", archive.Len(), warcReplay)
+		return archive, func() {}, nil
+	case warcOut != "":
+		f, err := warc.Create(warcOut)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating WARC file: %w", err)
+		}
+		log.Printf("Recording pages to %s", warcOut)
+		return warc.Recorder(f.Writer), func() {
+			if err := f.Close(); err != nil {
+				log.Printf("Error writing WARC file: %v", err)
+			}
+		}, nil
+	}
+	return page.NewContentRetriever(), func() {}, nil
+}
+
+// readItems gathers the items of each input in turn, along with the records that couldn't be read (and why).
+// An input is either a URL, - to read newline separated URLs from stdin, a .txt file of them, or a file, ZIP or
+// directory in one of the source.Formats. URLs are added now, so they are clipped just like a freshly saved Pocket entry.
+func readItems(inputs []string) ([]*source.Item, [][]string, error) {
+	now := time.Now()
+	items := []*source.Item{}
+	bad := [][]string{}
+	for _, input := range inputs {
+		var s source.Source
+		switch {
+		case input == "-":
+			urls, err := csv.ReadURLs(os.Stdin)
+			if err != nil {
+				return nil, nil, err
+			}
+			log.Printf("Read %d URLs from stdin", len(urls))
+			s = urlSource(urls, now)
+		case csv.IsURL(input):
+			s = urlSource([]string{input}, now)
+		case strings.EqualFold(filepath.Ext(input), ".txt"):
+			f, err := os.Open(input)
+			if err != nil {
+				return nil, nil, err
+			}
+			urls, err := csv.ReadURLs(f)
+			f.Close()
+			if err != nil {
+				return nil, nil, fmt.Errorf("error reading %s: %w", input, err)
+			}
+			log.Printf("Read %d URLs from %s", len(urls), input)
+			s = urlSource(urls, now)
+		default:
+			var format string
+			var err error
+			s, format, err = source.Open(input, inputFormat, source.Options{FolderAsTag: folderMode == folderModeTag, Now: now})
+			if err != nil {
+				return nil, nil, err
+			}
+			logSource(input, format, s)
+		}
+		read, badRecords, err := source.ReadAll(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, read...)
+		for _, b := range badRecords {
+			bad = append(bad, append(b.Record, b.Err.Error()))
+		}
+	}
+	return items, bad, nil
+}
+
+func urlSource(urls []string, now time.Time) source.Source {
+	items := make([]*source.Item, 0, len(urls))
+	for _, url := range urls {
+		items = append(items, source.URL(url, now))
+	}
+	return source.Items(items...)
+}
+
+// logSource logs what was found in an input file.
+func logSource(input string, format string, s source.Source) {
+	pocket, ok := s.(*source.PocketSource)
+	if !ok {
+		log.Printf("Reading %s export %s", format, input)
+		return
+	}
+	records := 0
+	for _, part := range pocket.Parts {
+		if len(pocket.Parts) > 1 {
+			log.Printf("Read %d records from %s", part.Records, part.Name)
+		}
+		records += part.Records
+	}
+	log.Printf("Read %d records from %s", records, input)
+	if pocket.Annotated > 0 {
+		log.Printf("Read highlights for %d articles from %s", pocket.Annotated, input)
+	}
+}
+
+// filterItems returns the items matching f.
+func filterItems(items []*source.Item, f *filter.Filter) []*source.Item {
+	matched := make([]*source.Item, 0, len(items))
+	for _, item := range items {
+		if f.Match(item.Page(false, nil)) {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
+
+// dropClipped removes items for articles already in the index, noting their tags to be merged into the existing note.
+func dropClipped(items []*source.Item, index *dedupe.Index) ([]*source.Item, int) {
+	kept := make([]*source.Item, 0, len(items))
+	for _, item := range items {
+		if path, ok := index.Lookup(item.URL); ok {
+			index.Merge(path, itemToPage(item).Tags)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept, len(items) - len(kept)
+}
+
+// itemToPage converts the item to a page with the --read and --tags defaults applied and its tags normalised.
+func itemToPage(item *source.Item) *page.Page {
+	p := item.Page(markRead, clippingTags)
+	p.Tags = tagRules.Normalise(p.Tags)
+	return p
+}
+
+// itemToClipping converts the item to a clipping, retrieving the page unless it is stored or --no-fetch.
+func itemToClipping(r page.ContentRetriever, item *source.Item) (*page.Clipping, error) {
+	p := itemToPage(item)
+	var c *page.Clipping
+	var err error
+	if dryRun && noFetch && p.HTML == "" {
+		c = page.NewClipping(p, nil)
+	} else if c, err = page.PageToClipping(r, p); err != nil {
+		return nil, err
+	}
+	c.AddHighlights(highlightsAs, markQuotes)
+	return c, nil
+}
+
+// processItem converts the item to a clipping and writes it to out, returning the path of its note, or with --dry-run
+// adds the outcome to the plan. An article already in the index (from the output directory or earlier in the run) isn't
+// written, its tags are merged into the existing note instead and a wrapped dedupe.ErrDuplicate is returned.
+func processItem(r page.ContentRetriever, index *dedupe.Index, out sink.Sink, p *plan.Plan, j job) (string, error) {
+	clipping, err := itemToClipping(r, j.item)
+	notePath := ""
+	if err == nil {
+		notePath = filepath.Join(outputDir, filepath.FromSlash(notesDir), clipping.Path())
+		if index != nil {
+			// the source may now be the page's canonical URL, so check again
+			if existing, claimed := index.Claim(clipping.Metadata.Source, notePath); !claimed {
+				index.Merge(existing, clipping.Metadata.Tags)
+				err = fmt.Errorf("%w of %s", dedupe.ErrDuplicate, existing)
+			}
+		}
+	}
+	snapshotName := ""
+	if err == nil && htmlSnapshot && clipping.Article != nil && !notesOnly() {
+		snapshotName = snapshotPath(notePath, clipping)
+		// properties only link with wikilinks
+		clipping.Metadata.Snapshot = vault.Links{Root: links().Root}.Link(notePath, filepath.Join(outputDir, filepath.FromSlash(snapshotName)), "")
+	}
+	if err == nil && siteDir != "" && clipping.Metadata.Domain != "" {
+		sitePath := filepath.Join(outputDir, filepath.FromSlash(siteDir), site.Path(clipping.Metadata.Domain))
+		clipping.Metadata.Site = vault.Links{Root: links().Root}.Link(notePath, sitePath, site.Name(clipping.Metadata.Site))
+	}
+	if dryRun {
+		p.Add(plan.NewChange(j.index, j.item.URL, notePath, clipping, err))
+		return notePath, err
+	}
+	if err != nil {
+		return "", err
+	}
+	if snapshotName != "" {
+		if err := writeSnapshot(r, out, snapshotName, clipping); err != nil {
+			return "", err
+		}
+	}
+	if err := writeClipping(out, clipping); err != nil {
+		return "", err
+	}
+	if !sink.IsDir(outputDir) {
+		written.add(vault.Note{Path: notePath, Clipping: clipping}) // a directory is scanned instead
+	}
+	return notePath, nil
+}
+
+// snapshotPath returns the name in the output of the snapshot of the clipping written to notePath:
+// in the vault's attachment folder, unless --attachments is given.
+func snapshotPath(notePath string, c *page.Clipping) string {
+	name := strings.TrimSuffix(c.Filename(), ".md") + ".html"
+	if settings == nil || settings.AttachmentFolder == "" || flag.CommandLine.Changed("attachments") {
+		return path.Join(attachDir, name)
+	}
+	return outputName(filepath.Join(settings.Attachments(notePath), name))
+}
+
+// writeSnapshot writes the HTML snapshot of the clipping's article to name in out.
+func writeSnapshot(r page.ContentRetriever, out sink.Sink, name string, c *page.Clipping) error {
+	b, err := c.Snapshot(r)
+	if err != nil {
+		return err
+	}
+	w, err := out.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return fmt.Errorf("error writing snapshot %s: %w", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing snapshot %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeClipping writes the clipping to its path in the notes folder of out.
+func writeClipping(out sink.Sink, c *page.Clipping) error {
+	name := path.Join(notesDir, filepath.ToSlash(c.Path()))
+	w, err := out.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := c.Write(w); err != nil {
+		w.Close()
+		return fmt.Errorf("error writing clipping %s: %w", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing clipping %s: %w", name, err)
+	}
+	return nil
+}
+
+// clippings returns every clipping in the output directory, or for an archive or stdout those written this run.
+func clippings() ([]vault.Note, error) {
+	if sink.IsDir(outputDir) {
+		return vault.Scan(outputDir)
+	}
+	return written.notes, nil
+}
+
+// writeMOCs writes the maps of content of the clippings, removing those no longer needed.
+func writeMOCs(out sink.Sink) {
+	all, err := clippings()
+	if err != nil {
+		log.Printf("Unable to generate maps of content: %v", err)
+		return
+	}
+	mocs := moc.Build(all)
+	for _, m := range mocs {
+		if err := writeGenerated(out, path.Join(mocDir, m.Path()), m.Markdown(links(), filepath.Join(outputDir, mocDir, filepath.FromSlash(m.Path())))); err != nil {
+			log.Printf("Unable to write map of content: %v", err)
+		}
+	}
+	if sink.IsDir(outputDir) {
+		dir := filepath.Join(outputDir, filepath.FromSlash(mocDir))
+		removed, err := vault.RemoveStale(dir, moc.GeneratedKind, moc.Paths(dir, mocs))
+		if err != nil {
+			log.Printf("Unable to remove maps of content: %v", err)
+		}
+		if removed > 0 {
+			log.Printf("Removed %d maps of content with no clippings", removed)
+		}
+	}
+	log.Printf("Wrote %d maps of content to %s", len(mocs), mocDir)
+}
+
+// findVault reads the settings of the Obsidian vault the output directory is in, if it is in one, and applies them.
+func findVault() error {
+	if !sink.IsDir(outputDir) {
+		return nil
+	}
+	if root, ok := vault.Find(outputDir); ok {
+		var err error
+		if settings, err = vault.ReadSettings(root); err != nil {
+			return fmt.Errorf("reading the vault's settings: %w", err)
+		}
+		log.Printf("Writing to the Obsidian vault %s", root)
+		applySettings()
+	}
+	return nil
+}
+
+// applySettings uses the vault's settings for the daily notes, unless they are given. When the output directory
+// is the root of the vault, the clippings are written to the vault's folder for new notes.
+func applySettings() {
+	if settings.NewNotesFolder != "" && sameDir(outputDir, settings.Root) {
+		notesDir = settings.NewNotesFolder
+		log.Printf("Writing the clippings to %s, the vault's folder for new notes", settings.NewNotes())
+	}
+	if !flag.CommandLine.Changed("daily-format") && settings.Daily.Format != "" {
+		dailyFormat = settings.Daily.Format
+	}
+	if !flag.CommandLine.Changed("daily-template") && settings.Daily.Template != "" {
+		dailyTmpl = settings.Daily.Template // a note of the vault
+	}
+	if useDaily && dailyDir == "" {
+		dailyDir = outputName(filepath.Join(settings.Root, filepath.FromSlash(settings.Daily.Folder)))
+	}
+}
+
+// sameDir reports whether the paths are the same directory.
+func sameDir(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// links returns how to link between notes: as the vault is set to, or with wikilinks from the output directory.
+func links() vault.Links {
+	if settings != nil {
+		return settings.Links
+	}
+	return vault.Links{Root: outputDir}
+}
+
+// outputName returns the name in the output directory of a path, / separated.
+func outputName(p string) string {
+	rel, err := filepath.Rel(outputDir, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writeTypes declares the types of the clipping properties in the vault's types.json.
+func writeTypes(out sink.Sink) {
+	types := filepath.Join(links().Root, filepath.FromSlash(vault.TypesPath))
+	var content []byte
+	if sink.IsDir(outputDir) {
+		b, err := os.ReadFile(types)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Unable to declare property types: %v", err)
+			return
+		}
+		content = b
+	}
+	merged, changed, err := vault.MergeTypes(content)
+	if err == nil && changed {
+		err = writeFile(out, outputName(types), merged)
+	}
+	if err != nil {
+		log.Printf("Unable to declare property types: %v", err)
+	}
+}
+
+// writeDashboards writes the dashboards, replacing the generated notes. Bases can't be marked as generated,
+// so they are only written if missing, keeping the user's changes, and aren't notes written to stdout.
+func writeDashboards(out sink.Sink) {
+	for _, f := range dashboard.Files(dashDir) {
+		var err error
+		if f.Generated() {
+			err = writeGenerated(out, f.Name, f.Content)
+		} else if !notesOnly() {
+			err = writeMissing(out, f.Name, f.Content)
+		}
+		if err != nil {
+			log.Printf("Unable to write dashboard: %v", err)
 		}
 	}
+	log.Printf("Wrote dashboards to %s", dashDir)
+}
 
+// writeSites writes a note per site, retrieving the home page of new sites for their details.
+func writeSites(out sink.Sink, r page.ContentRetriever) {
+	all, err := clippings()
+	if err != nil {
+		log.Printf("Unable to generate site notes: %v", err)
+		return
+	}
+	dir := filepath.Join(outputDir, filepath.FromSlash(siteDir))
+	sites := site.Build(all)
+	for _, s := range sites {
+		notePath := filepath.Join(dir, site.Path(s.Domain))
+		if existing, err := site.Read(notePath); err == nil {
+			if existing.Name != existing.Domain {
+				s.Name = existing.Name
+			}
+			s.URL, s.Favicon, s.Description = existing.URL, existing.Favicon, existing.Description
+		} else if content, _, err := r.Get(s.URL); err == nil && len(content) > 0 {
+			if err := s.Describe(content); err != nil {
+				log.Printf("Unable to describe site: %v", err)
+			}
+		}
+		if s.Favicon == "" {
+			s.Favicon = s.URL + "favicon.ico"
+		}
+		if err := writeGenerated(out, path.Join(siteDir, site.Path(s.Domain)), s.Markdown(links(), notePath)); err != nil {
+			log.Printf("Unable to write site note: %v", err)
+		}
+	}
+	if sink.IsDir(outputDir) {
+		removed, err := vault.RemoveStale(dir, site.GeneratedKind, site.Paths(dir, sites))
+		if err != nil {
+			log.Printf("Unable to remove site notes: %v", err)
+		}
+		if removed > 0 {
+			log.Printf("Removed %d site notes with no clippings", removed)
+		}
+	}
+	log.Printf("Wrote %d site notes to %s", len(sites), siteDir)
+}
+
+// writeCanvas writes the canvas of the clippings, unless there already is one: it may have been rearranged in Obsidian.
+func writeCanvas(out sink.Sink) {
+	if sink.IsDir(outputDir) {
+		if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(canvasFile))); err == nil {
+			log.Printf("Keeping the canvas %s, delete it to generate it again", canvasFile)
+			return
+		}
+	}
+	all, err := clippings()
+	if err != nil {
+		log.Printf("Unable to generate canvas: %v", err)
+		return
+	}
+	c, err := canvas.Build(links().Root, all, canvasGroup, canvasUnread)
+	if err == nil {
+		var b []byte
+		if b, err = c.JSON(); err == nil {
+			err = writeMissing(out, canvasFile, b)
+		}
+	}
+	if err != nil {
+		log.Printf("Unable to generate canvas: %v", err)
+		return
+	}
+	log.Printf("Wrote canvas %s", canvasFile)
+}
+
+// writeDaily adds the clippings to the daily notes of the days they were saved, creating the notes from
+// the template. Only the Saved section of the user's notes is changed.
+func writeDaily(out sink.Sink) {
+	all, err := clippings()
+	if err != nil {
+		log.Printf("Unable to add clippings to daily notes: %v", err)
+		return
+	}
+	template, err := readDailyTemplate()
+	if err != nil {
+		log.Printf("Unable to add clippings to daily notes: %v", err)
+		return
+	}
+	created, updated := 0, 0
+	for _, d := range daily.Build(all) {
+		name := d.Path(dailyDir, dailyFormat)
+		notePath := filepath.Join(outputDir, filepath.FromSlash(name))
+		content, err := os.ReadFile(notePath)
+		exists := err == nil && sink.IsDir(outputDir)
+		if !exists {
+			content = d.New(template, strings.TrimSuffix(path.Base(name), ".md"), dailyFormat, timeFormat(), time.Now())
+		}
+		content, added := d.AddSaved(content, links(), notePath)
+		if added == 0 && exists {
+			continue
+		}
+		if err := writeFile(out, name, content); err != nil {
+			log.Printf("Unable to write daily note: %v", err)
+			continue
+		}
+		if exists {
+			updated++
+		} else {
+			created++
+		}
+	}
+	log.Printf("Created %d and updated %d daily notes in %s", created, updated, dailyDir)
+}
+
+// timeFormat returns the format of {{time}} in templates, as the vault's templates settings set.
+func timeFormat() string {
+	if settings != nil {
+		return settings.TimeFormat
+	}
+	return ""
+}
+
+// readDailyTemplate reads the --daily-template file, or note of the output directory, the vault or its templates folder.
+func readDailyTemplate() ([]byte, error) {
+	if dailyTmpl == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(dailyTmpl)
+	if os.IsNotExist(err) && !filepath.IsAbs(dailyTmpl) {
+		folders := []string{outputDir}
+		if settings != nil {
+			folders = append(folders, settings.Root, filepath.Join(settings.Root, filepath.FromSlash(settings.TemplatesFolder)))
+		}
+		for _, folder := range folders {
+			note := filepath.Join(folder, filepath.FromSlash(dailyTmpl))
+			if filepath.Ext(note) != ".md" {
+				note += ".md"
+			}
+			if b, err = os.ReadFile(note); !os.IsNotExist(err) {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading daily note template: %w", err)
+	}
+	return b, nil
+}
+
+// writeGenerated writes a generated note to name in out, unless the user has a note of their own there.
+func writeGenerated(out sink.Sink, name string, content []byte) error {
+	if sink.IsDir(outputDir) {
+		generated, err := vault.Generated(filepath.Join(outputDir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if !generated {
+			return fmt.Errorf("not overwriting %s, it wasn't generated by %s", name, vault.GeneratedBy)
+		}
+	}
+	return writeFile(out, name, content)
+}
+
+// writeMissing writes content to name in out, unless the output directory already has a file there.
+func writeMissing(out sink.Sink, name string, content []byte) error {
+	if sink.IsDir(outputDir) {
+		if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(name))); err == nil {
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeFile(out, name, content)
+}
+
+// writeFile writes content to name in out.
+func writeFile(out sink.Sink, name string, content []byte) error {
+	w, err := out.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		w.Close()
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// linkClippings rewrites the links between the clippings in the output directory as links to their notes.
+func linkClippings() {
+	all, err := vault.Scan(outputDir)
+	if err != nil {
+		log.Printf("Unable to link clippings: %v", err)
+		return
+	}
+	x := crosslink.NewIndex(all)
+	rewritten, updated := 0, 0
+	for _, n := range all {
+		count, err := x.RewriteNote(n.Path, links())
+		if err != nil {
+			log.Printf("Unable to link clippings in %s: %v", n.Path, err)
+			continue
+		}
+		if count > 0 {
+			rewritten += count
+			updated++
+		}
+	}
+	if rewritten > 0 {
+		log.Printf("Linked %d links between clippings in %d notes", rewritten, updated)
+	}
+}
+
+// mergeTags adds the tags of duplicate records to the notes they duplicate.
+func mergeTags(merges map[string][]string) {
+	updated := 0
+	for path, tags := range merges {
+		if dryRun {
+			log.Printf("Would merge tags %v into %s", tags, path)
+			continue
+		}
+		changed, err := vault.MergeTags(path, tags)
+		if err != nil {
+			log.Printf("Unable to merge tags into %s: %v", path, err)
+			continue
+		}
+		if changed {
+			updated++
+		}
+	}
+	if updated > 0 {
+		log.Printf("Merged tags from duplicates into %d notes", updated)
+	}
+}
+
+// writePlan resolves the dry run plan against the output directory and reports it on stdout.
+func writePlan(p *plan.Plan) error {
+	p.Resolve(func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	if dryRunFormat == "json" {
+		return p.WriteJSON(os.Stdout)
+	}
+	return p.WriteText(os.Stdout)
 }
 
 // Used to process the results channel, we know how many results we need to get
-func processResults(failedList *[][]string, numRecords int, results chan Result, bar *mpb.Bar, failedBar *mpb.Bar) {
+// Returns the number of duplicates found, these are not failures.
+func processResults(failedList *[][]string, numRecords int, results chan Result, bar *mpb.Bar, failedBar *mpb.Bar) int {
+	duplicates := 0
 	for i := numRecords; i > 0; i-- {
 		r, ok := <-results
 		if !ok {
-			return
+			return duplicates
 		}
 		bar.Increment()
-		if r.Err != nil {
-			*failedList = append(*failedList, append(r.Record, r.Err.Error()))
+		if errors.Is(r.Err, dedupe.ErrDuplicate) {
+			duplicates++
+		} else if r.Err != nil {
+			*failedList = append(*failedList, append(r.Item.Record(), r.Err.Error()))
 			failedBar.Increment()
 		}
 	}
+	return duplicates
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fergalsomers/pocket-obsidian/search"
+
+	flag "github.com/spf13/pflag"
+)
+
+// searchCommand is the subcommand searching the clippings of an output directory.
+const searchCommand = "search"
+
+// runSearch runs the search subcommand with its arguments, returning the exit status: 1 if nothing matched or on an error.
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet(searchCommand, flag.ContinueOnError)
+	dir := fs.StringP("output-dir", "o", defaultOutpurDir, "Directory of the clippings to search")
+	indexPath := fs.String("index", "", "Search index, updated before searching, defaults to "+search.DefaultPath+" in the output directory")
+	limit := fs.IntP("limit", "l", 20, "Most results to show, 0 for all of them")
+	rebuild := fs.Bool("rebuild", false, "Rebuild the index instead of updating it")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, "Usage of pocket-obsidian search [flags] query\n"+
+			"The query is words, \"quoted phrases\" and filters: tag:ai, site:hbr, domain:hbr.org, read:false\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 1
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, "Error missing argument query\n\n")
+		fs.Usage()
+		return 1
+	}
+	q, err := search.Parse(strings.Join(fs.Args(), " "))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error %s is not a directory of clippings\n", *dir)
+		return 1
+	}
+	if *indexPath == "" {
+		*indexPath = filepath.Join(*dir, search.DefaultPath)
+	}
+
+	x := search.New()
+	if !*rebuild {
+		if x, err = search.Load(*indexPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+	}
+	stats, err := x.Update(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if stats != (search.Stats{}) {
+		fmt.Fprintf(os.Stderr, "Indexed %d new, %d changed and %d deleted notes\n", stats.Added, stats.Updated, stats.Removed)
+		if err := x.Save(*indexPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+	}
+
+	results := x.Search(q, *limit)
+	if len(results) == 0 {
+		fmt.Fprint(os.Stderr, "No clippings matched\n")
+		return 1
+	}
+	for _, r := range results {
+		printResult(r)
+	}
+	return 0
+}
+
+// printResult prints a search result: its score (when ranked), title and details, then the note's path.
+func printResult(r search.Result) {
+	d := r.Doc
+	details := []string{}
+	if d.Site != "" {
+		details = append(details, d.Site)
+	}
+	if len(d.Created) >= len("2006-01-02") {
+		details = append(details, d.Created[:len("2006-01-02")])
+	}
+	if d.Read {
+		details = append(details, "read")
+	}
+	title := d.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(d.Path), ".md")
+	}
+	if r.Score > 0 {
+		fmt.Printf("%5.2f ", r.Score)
+	}
+	fmt.Printf("%s (%s)\n      %s\n", title, strings.Join(details, ", "), d.Path)
+}
@@ -0,0 +1,217 @@
+package search
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fergalsomers/pocket-obsidian/site"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// Version of the index format, an index of another version is rebuilt.
+const Version = 1
+
+// DefaultPath is where the index of a vault is kept, relative to it. Obsidian ignores hidden folders.
+const DefaultPath = ".pocket-obsidian/search.index"
+
+// Doc is a note in the index.
+type Doc struct {
+	Path     string // relative to the indexed directory, / separated
+	ModTime  time.Time
+	Size     int64
+	Clipping bool // notes which aren't clippings aren't searched, but are kept so they aren't read again
+	Title    string
+	Source   string
+	Site     string // the site's name
+	Domain   string
+	Created  string
+	Tags     []string
+	Read     bool
+	Length   int      // number of terms
+	Terms    []string // distinct terms, to remove the note from the postings
+}
+
+// Index is an inverted index of the clippings in a directory.
+type Index struct {
+	Version     int
+	Docs        map[string]*Doc
+	Postings    map[string]map[string][]int // positions of each term in each note, by path
+	TotalLength int                         // of the clippings, for their average length
+}
+
+// Stats are the changes made by Update.
+type Stats struct {
+	Added   int
+	Updated int
+	Removed int
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{Version: Version, Docs: map[string]*Doc{}, Postings: map[string]map[string][]int{}}
+}
+
+// Load reads the index at path. A missing index, or one of another version, is empty.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening search index: %w", err)
+	}
+	defer f.Close()
+	x := New()
+	if err := gob.NewDecoder(f).Decode(x); err != nil || x.Version != Version {
+		return New(), nil // rebuilt
+	}
+	return x, nil
+}
+
+// Save writes the index to path, replacing it once written.
+func (x *Index) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating directory for search index: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing search index: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := gob.NewEncoder(f).Encode(x); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing search index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing search index: %w", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Update brings the index up to date with the notes below dir: notes changed since they were indexed
+// (by modification time and size) are read again, and deleted notes removed.
+func (x *Index) Update(dir string) (Stats, error) {
+	var stats Stats
+	seen := map[string]bool{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		old, ok := x.Docs[rel]
+		if ok && old.ModTime.Equal(info.ModTime()) && old.Size == info.Size() {
+			return nil
+		}
+		if ok {
+			x.remove(old)
+			stats.Updated++
+		} else {
+			stats.Added++
+		}
+		x.add(read(path, rel, info))
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("error indexing %s: %w", dir, err)
+	}
+	for path, doc := range x.Docs {
+		if !seen[path] {
+			x.remove(doc)
+			stats.Removed++
+		}
+	}
+	return stats, nil
+}
+
+// markdownURL matches the URL of a Markdown link or image, which isn't indexed.
+var markdownURL = regexp.MustCompile(`\]\([^)]*\)`)
+
+// read reads the note at path into a Doc.
+func read(path string, rel string, info fs.FileInfo) *Doc {
+	doc := &Doc{Path: rel, ModTime: info.ModTime(), Size: info.Size()}
+	c, err := vault.ReadNote(path)
+	if err != nil || c.Metadata.Source == "" {
+		return doc
+	}
+	md := c.Metadata
+	doc.Clipping = true
+	doc.Title = md.Title
+	doc.Source = md.Source
+	doc.Site = site.Name(md.Site)
+	doc.Domain = md.Domain
+	doc.Created = md.Created
+	doc.Tags = md.Tags
+	doc.Read = md.Read
+	doc.Terms = Tokenize(md.Title + "\n" + md.Description + "\n" + markdownURL.ReplaceAllString(string(c.MarkdownContent), "]"))
+	doc.Length = len(doc.Terms)
+	return doc
+}
+
+// add adds the doc, whose Terms are all of its terms in order, to the index.
+func (x *Index) add(doc *Doc) {
+	x.Docs[doc.Path] = doc
+	if !doc.Clipping {
+		doc.Terms = nil
+		return
+	}
+	distinct := []string{}
+	for i, t := range doc.Terms {
+		postings, ok := x.Postings[t]
+		if !ok {
+			postings = map[string][]int{}
+			x.Postings[t] = postings
+		}
+		if _, ok := postings[doc.Path]; !ok {
+			distinct = append(distinct, t)
+		}
+		postings[doc.Path] = append(postings[doc.Path], i)
+	}
+	doc.Terms = distinct
+	x.TotalLength += doc.Length
+}
+
+// remove removes the doc from the index.
+func (x *Index) remove(doc *Doc) {
+	for _, t := range doc.Terms {
+		delete(x.Postings[t], doc.Path)
+		if len(x.Postings[t]) == 0 {
+			delete(x.Postings, t)
+		}
+	}
+	if doc.Clipping {
+		x.TotalLength -= doc.Length
+	}
+	delete(x.Docs, doc.Path)
+}
+
+// Tokenize splits text into lower case terms: runs of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
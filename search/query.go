@@ -0,0 +1,219 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BM25 parameters.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Query is a parsed search: words, which a clipping must all contain, phrases, which it must contain
+// in order, and filters on its properties.
+type Query struct {
+	Terms   []string
+	Phrases [][]string
+	Tags    []string
+	Sites   []string
+	Domains []string
+	Read    *bool
+}
+
+// Parse parses a query of words, "quoted phrases" and field filters: tag:x, site:x, domain:x and read:true or read:false.
+// Filter values can be quoted, and a word splitting into several terms, like state-of-the-art, is a phrase.
+func Parse(query string) (*Query, error) {
+	q := &Query{}
+	for _, w := range split(query) {
+		field, value, ok := strings.Cut(w, ":")
+		if ok && !strings.HasPrefix(w, `"`) {
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(field) {
+			case "tag":
+				q.Tags = append(q.Tags, strings.TrimPrefix(value, "#"))
+				continue
+			case "site":
+				q.Sites = append(q.Sites, value)
+				continue
+			case "domain":
+				q.Domains = append(q.Domains, value)
+				continue
+			case "read":
+				read, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid read filter %q, should be true or false", value)
+				}
+				q.Read = &read
+				continue
+			}
+		}
+		terms := Tokenize(w)
+		switch {
+		case len(terms) == 1:
+			q.Terms = append(q.Terms, terms[0])
+		case len(terms) > 1:
+			q.Phrases = append(q.Phrases, terms)
+		}
+	}
+	return q, nil
+}
+
+// split splits the query on spaces outside of quotes.
+func split(query string) []string {
+	var words []string
+	var w strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			w.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if w.Len() > 0 {
+				words = append(words, w.String())
+				w.Reset()
+			}
+		default:
+			w.WriteRune(r)
+		}
+	}
+	if w.Len() > 0 {
+		words = append(words, w.String())
+	}
+	return words
+}
+
+// Result is a clipping matching a query.
+type Result struct {
+	Doc   *Doc
+	Score float64
+}
+
+// Search returns the clippings matching the query ranked by BM25, or newest first when the query only filters.
+// Limit is the most returned, 0 for all of them.
+func (x *Index) Search(q *Query, limit int) []Result {
+	// each term is scored once, however often it is in the query
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, t := range slices.Concat(append([][]string{q.Terms}, q.Phrases...)...) {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	n := 0
+	for _, doc := range x.Docs {
+		if doc.Clipping {
+			n++
+		}
+	}
+	average := float64(x.TotalLength) / math.Max(float64(n), 1)
+	var results []Result
+	for path, doc := range x.Docs {
+		if !doc.Clipping || !q.matches(doc) || !x.contains(path, terms) {
+			continue
+		}
+		matched := true
+		for _, p := range q.Phrases {
+			if !x.phrase(path, p) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			results = append(results, Result{Doc: doc, Score: x.score(doc, terms, n, average)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Doc.Created != b.Doc.Created {
+			return a.Doc.Created > b.Doc.Created
+		}
+		return a.Doc.Path < b.Doc.Path
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// matches reports whether the doc passes the filters of the query.
+func (q *Query) matches(doc *Doc) bool {
+	if q.Read != nil && doc.Read != *q.Read {
+		return false
+	}
+	for _, tag := range q.Tags {
+		found := false
+		for _, t := range doc.Tags {
+			// a tag also matches its nested tags
+			if strings.EqualFold(t, tag) || strings.HasPrefix(strings.ToLower(t), strings.ToLower(tag)+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, s := range q.Sites {
+		if !strings.Contains(strings.ToLower(doc.Site), strings.ToLower(s)) && !strings.EqualFold(doc.Domain, s) {
+			return false
+		}
+	}
+	for _, d := range q.Domains {
+		if !strings.EqualFold(doc.Domain, d) && !strings.HasSuffix(strings.ToLower(doc.Domain), "."+strings.ToLower(d)) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether the doc at path has all of the terms.
+func (x *Index) contains(path string, terms []string) bool {
+	for _, t := range terms {
+		if _, ok := x.Postings[t][path]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// phrase reports whether the doc at path has the terms of the phrase in order.
+func (x *Index) phrase(path string, phrase []string) bool {
+	for _, start := range x.Postings[phrase[0]][path] {
+		found := true
+		for i, t := range phrase[1:] {
+			positions := x.Postings[t][path]
+			j := sort.SearchInts(positions, start+i+1)
+			if j == len(positions) || positions[j] != start+i+1 {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// score returns the BM25 score of the doc for the terms, among n clippings of the average length.
+func (x *Index) score(doc *Doc, terms []string, n int, average float64) float64 {
+	score := 0.0
+	for _, t := range terms {
+		df := float64(len(x.Postings[t]))
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		tf := float64(len(x.Postings[t][doc.Path]))
+		score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(doc.Length)/math.Max(average, 1)))
+	}
+	return score
+}
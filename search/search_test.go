@@ -0,0 +1,127 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSearch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "search suite")
+}
+
+func write(dir string, path string, content string) {
+	path = filepath.Join(dir, path)
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+}
+
+func paths(results []Result) []string {
+	paths := []string{}
+	for _, r := range results {
+		paths = append(paths, r.Doc.Path)
+	}
+	return paths
+}
+
+func search(x *Index, query string) []string {
+	q, err := Parse(query)
+	Expect(err).To(BeNil())
+	return paths(x.Search(q, 0))
+}
+
+var _ = Describe("SearchTest", func() {
+
+	var dir string
+	var x *Index
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		write(dir, "AI CEOs.md", "---\ntitle: AI CEOs\nsource: https://hbr.org/ai-ceos\ncreated: 2025-05-22T10:04:05\ntags: [ai, leadership]\nsite: \"[[Sites/hbr.org|Harvard Business Review]]\"\ndomain: hbr.org\nread: true\n---\n"+
+			"Large language models are changing how a CEO leads. [Models](https://example.com/models) help.\n")
+		write(dir, "Tech/Istio.md", "---\ntitle: Istio ambient mode\nsource: https://aws.amazon.com/istio\ncreated: 2025-05-16\ntags: [tech/kubernetes]\nsite: aws.amazon.com\ndomain: aws.amazon.com\n---\n"+
+			"A service mesh without sidecars. Language of the mesh: models of traffic, models of policy, models everywhere.\n")
+		write(dir, "Notes.md", "# Notes\nlanguage models\n")
+		write(dir, ".obsidian/Hidden.md", "---\nsource: https://example.com\n---\nmodels\n")
+		x = New()
+		stats, err := x.Update(dir)
+		Expect(err).To(BeNil())
+		Expect(stats).To(Equal(Stats{Added: 3}))
+	})
+
+	It("Should rank the clippings by BM25", func() {
+		Expect(search(x, "models")).To(Equal([]string{"Tech/Istio.md", "AI CEOs.md"}), "more occurrences in a note of similar length")
+		Expect(search(x, "Models CEO")).To(Equal([]string{"AI CEOs.md"}), "all of the words")
+		Expect(search(x, "unicorn")).To(BeEmpty())
+		Expect(search(x, "")).To(Equal([]string{"AI CEOs.md", "Tech/Istio.md"}), "newest first")
+	})
+
+	It("Should score repeated terms once", func() {
+		score := func(query string) float64 {
+			q, err := Parse(query)
+			Expect(err).To(BeNil())
+			results := x.Search(q, 0)
+			Expect(results).NotTo(BeEmpty())
+			return results[0].Score
+		}
+		Expect(score("models models")).To(Equal(score("models")))
+		Expect(score(`models "language models"`)).To(Equal(score(`"language models"`)))
+	})
+
+	It("Should match phrases", func() {
+		Expect(search(x, `"language models"`)).To(Equal([]string{"AI CEOs.md"}))
+		Expect(search(x, `service-mesh`)).To(Equal([]string{"Tech/Istio.md"}))
+		Expect(search(x, `"mesh service"`)).To(BeEmpty())
+		Expect(search(x, `example`)).To(BeEmpty(), "link URLs aren't indexed")
+	})
+
+	It("Should filter by tag, site and read state", func() {
+		Expect(search(x, "models tag:AI")).To(Equal([]string{"AI CEOs.md"}))
+		Expect(search(x, "tag:tech")).To(Equal([]string{"Tech/Istio.md"}), "nested tags")
+		Expect(search(x, `site:"harvard business"`)).To(Equal([]string{"AI CEOs.md"}))
+		Expect(search(x, "site:aws.amazon.com")).To(Equal([]string{"Tech/Istio.md"}))
+		Expect(search(x, "domain:amazon.com")).To(Equal([]string{"Tech/Istio.md"}))
+		Expect(search(x, "read:false")).To(Equal([]string{"Tech/Istio.md"}))
+		_, err := Parse("read:maybe")
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("Should update the index incrementally", func() {
+		write(dir, "Tech/Istio.md", "---\ntitle: Istio\nsource: https://aws.amazon.com/istio\n---\nSidecars are gone.\n")
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(filepath.Join(dir, "Tech", "Istio.md"), later, later)).To(Succeed())
+		Expect(os.Remove(filepath.Join(dir, "AI CEOs.md"))).To(Succeed())
+		write(dir, "New.md", "---\ntitle: New\nsource: https://example.com/new\n---\nmodels\n")
+		stats, err := x.Update(dir)
+		Expect(err).To(BeNil())
+		Expect(stats).To(Equal(Stats{Added: 1, Updated: 1, Removed: 1}))
+		Expect(search(x, "models")).To(Equal([]string{"New.md"}))
+		Expect(search(x, "sidecars")).To(Equal([]string{"Tech/Istio.md"}))
+		Expect(x.Postings).ToNot(HaveKey("ceo"))
+
+		stats, err = x.Update(dir)
+		Expect(err).To(BeNil())
+		Expect(stats).To(Equal(Stats{}))
+	})
+
+	It("Should save and load the index", func() {
+		path := filepath.Join(dir, DefaultPath)
+		Expect(x.Save(path)).To(Succeed())
+		loaded, err := Load(path)
+		Expect(err).To(BeNil())
+		Expect(search(loaded, `"language models"`)).To(Equal([]string{"AI CEOs.md"}))
+		stats, err := loaded.Update(dir)
+		Expect(err).To(BeNil())
+		Expect(stats).To(Equal(Stats{}))
+
+		Expect(os.WriteFile(path, []byte("not an index"), 0644)).To(Succeed())
+		loaded, err = Load(path)
+		Expect(err).To(BeNil())
+		Expect(loaded.Docs).To(BeEmpty(), "rebuilt")
+	})
+})
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/dedupe"
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/server"
+	"github.com/fergalsomers/pocket-obsidian/sink"
+	"github.com/fergalsomers/pocket-obsidian/source"
+
+	flag "github.com/spf13/pflag"
+)
+
+// serveCommand is the subcommand running a local server which clips the pages sent to it.
+const serveCommand = "serve"
+
+// runServe runs the serve subcommand with its arguments until interrupted, returning the exit status.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet(serveCommand, flag.ContinueOnError)
+	addr := fs.String("addr", server.DefaultAddr, "Address to listen on, only this machine can reach the default")
+	fs.StringVarP(&outputDir, "output-dir", "o", defaultOutpurDir, "Directory to write the clippings to")
+	fs.StringArrayVarP(&clippingTags, "tags", "t", defaultTags, "Default tags to add to every clipping")
+	token := fs.String("token", "", "Secret the bookmarklet and other clients must send as the token parameter, so other web pages can't clip into the vault (default a new random one each time)")
+	queueSize := fs.Int("queue", 100, "Most pages waiting to be clipped")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, "Usage of pocket-obsidian serve [flags]\n"+
+			"Open the address in a browser for the bookmarklet. POST /clip with the token and url (and optionally title, html and tags) to clip a page, GET /status for progress\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 1
+	}
+	if !sink.IsDir(outputDir) {
+		fmt.Fprintf(os.Stderr, "Error serve writes to a directory, not %s\n", outputDir)
+		return 1
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if err := findVault(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	index, err := dedupe.Load(outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading existing notes: %v\n", err)
+		return 1
+	}
+	log.Printf("Found %d clippings in %s", index.Len(), outputDir)
+
+	s, err := server.New(clipper(page.NewContentRetriever(), index, sink.Dir(outputDir)), *queueSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if *token != "" {
+		s.Token = *token
+	}
+	if host, _, err := net.SplitHostPort(*addr); err == nil && host != "" {
+		s.Hosts = append(s.Hosts, host) // listening on another address, reached by it
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan bool)
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	srv := &http.Server{Addr: *addr, Handler: s.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	log.Printf("Clipping to %s, open http://%s for the bookmarklet, clip requests must send the token %s", outputDir, *addr, s.Token)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	<-done // finish the page being clipped
+	if queued := s.Status().Counts[server.StateQueued]; queued > 0 {
+		log.Printf("Stopped with %d pages not clipped", queued)
+	}
+	return 0
+}
+
+// clipper returns the pipeline of the main command for one item, clipping it into out unless it is in the index.
+// Tags of duplicates are merged into the existing note straight away.
+func clipper(r page.ContentRetriever, index *dedupe.Index, out sink.Sink) server.Clipper {
+	return func(item *source.Item) (string, error) {
+		var notePath string
+		var err error
+		if existing, ok := index.Lookup(item.URL); ok {
+			index.Merge(existing, itemToPage(item).Tags)
+			err = fmt.Errorf("%w of %s", dedupe.ErrDuplicate, existing)
+		} else {
+			notePath, err = processItem(r, index, out, nil, job{item: item})
+		}
+		switch {
+		case errors.Is(err, dedupe.ErrDuplicate):
+			log.Printf("Skipping %s: %v", item.URL, err)
+			mergeTags(index.Drain())
+		case err != nil:
+			log.Printf("Unable to clip %s: %v", item.URL, err)
+		default:
+			log.Printf("Clipped %s to %s", item.URL, notePath)
+		}
+		return notePath, err
+	}
+}
@@ -0,0 +1,356 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/dedupe"
+	"github.com/fergalsomers/pocket-obsidian/source"
+)
+
+// DefaultAddr is the address the server listens on by default, only reachable from this machine.
+const DefaultAddr = "127.0.0.1:8421"
+
+// maxBody is the largest request accepted, a page's HTML posted by the bookmarklet.
+const maxBody = 32 << 20
+
+// States of a job.
+const (
+	StateQueued    = "queued"
+	StateClipping  = "clipping"
+	StateDone      = "done"
+	StateDuplicate = "duplicate" // already in the vault, its tags were merged into the existing note
+	StateFailed    = "failed"
+)
+
+// ErrQueueFull is returned by Add when there are too many jobs waiting to be clipped.
+var ErrQueueFull = errors.New("too many pages waiting to be clipped")
+
+// Clipper clips an item into the vault, returning the path of its note. It is the conversion pipeline of the
+// main command, injected so the server can be tested without it. A wrapped dedupe.ErrDuplicate marks an article
+// that is already clipped.
+type Clipper func(item *source.Item) (string, error)
+
+// Job is a page sent to the server to be clipped.
+type Job struct {
+	ID    int       `json:"id"`
+	URL   string    `json:"url"`
+	Title string    `json:"title,omitempty"`
+	State string    `json:"state"`
+	Note  string    `json:"note,omitempty"`  // path of the note, once clipped
+	Error string    `json:"error,omitempty"` // why it failed
+	Added time.Time `json:"added"`
+
+	item *source.Item
+}
+
+// Status is the response of the status endpoint: the number of jobs in each state and the jobs, newest first.
+type Status struct {
+	Counts map[string]int `json:"counts"`
+	Jobs   []Job          `json:"jobs"`
+}
+
+// Server accepts pages to clip over HTTP, queueing them to be clipped one at a time by Run.
+// Only requests for a loopback host, or one of Hosts, are served, so a web page rebinding its
+// DNS name to this machine can't read the token or the status.
+type Server struct {
+	Token string   // if set, required as the token parameter of a clip request
+	Hosts []string // host names or addresses the server is reached by other than loopback ones
+	Now   func() time.Time
+
+	clip  Clipper
+	queue chan *Job
+	mu    sync.Mutex
+	jobs  []*Job
+}
+
+// New returns a server clipping with clip, with room for size jobs waiting to be clipped.
+// It requires a random token, set Token to require another.
+func New(clip Clipper, size int) (*Server, error) {
+	token, err := NewToken()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Token: token, Now: time.Now, clip: clip, queue: make(chan *Job, size)}, nil
+}
+
+// NewToken returns a random token.
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Add queues the item to be clipped.
+func (s *Server) Add(item *source.Item) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := &Job{ID: len(s.jobs) + 1, URL: item.URL, Title: item.Title, State: StateQueued, Added: s.Now(), item: item}
+	select {
+	case s.queue <- j:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	s.jobs = append(s.jobs, j)
+	return *j, nil
+}
+
+// Run clips the queued jobs, one at a time, until ctx is done. The job being clipped is finished first.
+func (s *Server) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-s.queue:
+			s.update(j, func(j *Job) { j.State = StateClipping })
+			note, err := s.clip(j.item)
+			s.update(j, func(j *Job) {
+				j.Note = note
+				j.State = StateDone
+				if errors.Is(err, dedupe.ErrDuplicate) {
+					j.State = StateDuplicate
+				} else if err != nil {
+					j.State = StateFailed
+				}
+				if err != nil {
+					j.Error = err.Error()
+				}
+				j.item = nil // free the page's HTML
+			})
+		}
+	}
+}
+
+func (s *Server) update(j *Job, f func(j *Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(j)
+}
+
+// Job returns the job with the id.
+func (s *Server) Job(id int) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.jobs) {
+		return Job{}, false
+	}
+	return *s.jobs[id-1], true
+}
+
+// Status returns the jobs, newest first, and the number in each state.
+func (s *Server) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := Status{Counts: map[string]int{StateQueued: 0, StateClipping: 0, StateDone: 0, StateDuplicate: 0, StateFailed: 0}, Jobs: []Job{}}
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		status.Counts[s.jobs[i].State]++
+		status.Jobs = append(status.Jobs, *s.jobs[i])
+	}
+	return status
+}
+
+// Handler returns the server's endpoints:
+//   - GET / a page with the bookmarklet and a form to clip a URL
+//   - POST /clip queues the url parameter, with the optional title, html of the page and tags (comma separated
+//     or repeated). Form and JSON bodies are accepted, the response is the job as JSON if asked for, otherwise a page.
+//   - GET /status the Status as JSON, GET /status/{id} a job
+//
+// Requests for other hosts are forbidden.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.home)
+	mux.HandleFunc("POST /clip", s.clipHandler)
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Status())
+	})
+	mux.HandleFunc("GET /status/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		j, ok := s.Job(id)
+		if err != nil || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, j)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			http.Error(w, "unknown host "+r.Host, http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether the Host header of a request is a loopback name or address, or one of Hosts.
+func (s *Server) allowedHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport // no port
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, h := range s.Hosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// clipRequest is the body of a JSON clip request.
+type clipRequest struct {
+	URL   string   `json:"url"`
+	Title string   `json:"title"`
+	HTML  string   `json:"html"`
+	Tags  []string `json:"tags"`
+	Token string   `json:"token"`
+}
+
+func (s *Server) clipHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := readClipRequest(w, r)
+	if err != nil {
+		s.respond(w, r, http.StatusBadRequest, Job{}, err)
+		return
+	}
+	if s.Token != "" && req.Token != s.Token {
+		s.respond(w, r, http.StatusForbidden, Job{}, errors.New("missing or wrong token"))
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		s.respond(w, r, http.StatusBadRequest, Job{}, fmt.Errorf("invalid url %q, expected an http or https URL", req.URL))
+		return
+	}
+	item := source.URL(req.URL, s.Now())
+	if title := strings.TrimSpace(req.Title); title != "" {
+		item.Title = title
+	}
+	item.HTML = req.HTML
+	for _, t := range req.Tags {
+		for _, tag := range strings.Split(t, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+	}
+	j, err := s.Add(item)
+	if err != nil {
+		w.Header().Set("Retry-After", "60")
+		s.respond(w, r, http.StatusServiceUnavailable, Job{}, err)
+		return
+	}
+	s.respond(w, r, http.StatusAccepted, j, nil)
+}
+
+// readClipRequest reads a clip request from a JSON or form body.
+func readClipRequest(w http.ResponseWriter, r *http.Request) (clipRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	var req clipRequest
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, fmt.Errorf("error reading request: %w", err)
+		}
+		return req, nil
+	}
+	if err := r.ParseMultipartForm(maxBody); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return req, fmt.Errorf("error reading request: %w", err)
+	}
+	return clipRequest{
+		URL:   r.PostFormValue("url"),
+		Title: r.PostFormValue("title"),
+		HTML:  r.PostFormValue("html"),
+		Tags:  r.PostForm["tags"],
+		Token: r.PostFormValue("token"),
+	}, nil
+}
+
+// respond writes the job, or the error, as JSON if the client asked for JSON, otherwise as a page.
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, code int, j Job, err error) {
+	wantsJSON := strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	switch {
+	case wantsJSON && err != nil:
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+	case wantsJSON:
+		writeJSON(w, code, j)
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		resultPage.Execute(w, map[string]any{"Job": j, "Err": err})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) home(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	homePage.Execute(w, map[string]any{
+		"Bookmarklet": template.URL(Bookmarklet("http://"+r.Host, s.Token)),
+		"Token":       s.Token,
+		"Status":      s.Status(),
+	})
+}
+
+// Bookmarklet returns a javascript: URL which posts the current page, with its HTML, to the server at base.
+// Posting a form in a new tab works from any page, without the server allowing cross-origin requests.
+func Bookmarklet(base string, token string) string {
+	fields := "[['url',location.href],['title',document.title],['html',document.documentElement.outerHTML]"
+	if token != "" {
+		fields += ",['token'," + strconv.Quote(token) + "]"
+	}
+	return "javascript:(function(){var f=document.createElement('form');f.method='POST';" +
+		"f.action=" + strconv.Quote(strings.TrimSuffix(base, "/")+"/clip") + ";f.target='_blank';f.acceptCharset='utf-8';" +
+		fields + "].forEach(function(p){var i=document.createElement('input');i.type='hidden';i.name=p[0];i.value=p[1];f.appendChild(i)});" +
+		"document.body.appendChild(f);f.submit();f.remove()})()"
+}
+
+var homePage = template.Must(template.New("home").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>pocket-obsidian</title></head>
+<body>
+<h1>pocket-obsidian</h1>
+<p>Drag this bookmarklet to your bookmarks bar, then click it on a page to clip it: <a href="{{.Bookmarklet}}">Clip to Obsidian</a></p>
+<form method="post" action="/clip">
+<input type="url" name="url" placeholder="https://" required size="60">
+<input type="text" name="tags" placeholder="tags, comma separated">
+{{if .Token}}<input type="hidden" name="token" value="{{.Token}}">{{end}}
+<button type="submit">Clip</button>
+</form>
+<h2>Recent clippings</h2>
+<ul>
+{{range .Status.Jobs}}<li>{{.State}}: <a href="{{.URL}}">{{if .Title}}{{.Title}}{{else}}{{.URL}}{{end}}</a>{{if .Error}} ({{.Error}}){{end}}</li>
+{{end}}</ul>
+</body></html>
+`))
+
+var resultPage = template.Must(template.New("result").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>pocket-obsidian</title></head>
+<body>
+{{if .Err}}<p>Not clipped: {{.Err}}</p>
+{{else}}<p>Clipping {{if .Job.Title}}{{.Job.Title}}{{else}}{{.Job.URL}}{{end}}, see <a href="/status/{{.Job.ID}}">its status</a>.</p>
+<script>setTimeout(function(){window.close()}, 1500)</script>
+{{end}}</body></html>
+`))
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/dedupe"
+	"github.com/fergalsomers/pocket-obsidian/source"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "server suite")
+}
+
+// fakeClipper records the items it clips, failing those whose URL contains "fail" and those already clipped.
+type fakeClipper struct {
+	mu    sync.Mutex
+	items []*source.Item
+}
+
+func (f *fakeClipper) clip(item *source.Item) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, i := range f.items {
+		if i.URL == item.URL {
+			return "", fmt.Errorf("%w of %s.md", dedupe.ErrDuplicate, i.Title)
+		}
+	}
+	if strings.Contains(item.URL, "fail") {
+		return "", fmt.Errorf("error retrieving %s", item.URL)
+	}
+	f.items = append(f.items, item)
+	return item.Title + ".md", nil
+}
+
+func decode(res *http.Response, v any) {
+	defer res.Body.Close()
+	Expect(json.NewDecoder(res.Body).Decode(v)).To(Succeed())
+}
+
+var _ = Describe("ServerTest", func() {
+
+	var clipper *fakeClipper
+	var s *Server
+	var ts *httptest.Server
+
+	BeforeEach(func() {
+		clipper = &fakeClipper{}
+		var err error
+		s, err = New(clipper.clip, 2)
+		Expect(err).To(BeNil())
+		Expect(s.Token).To(HaveLen(32), "a random token is required by default")
+		s.Token = "s3cret"
+		ts = httptest.NewServer(s.Handler())
+		DeferCleanup(ts.Close)
+	})
+
+	// run clips the queued jobs, stopping once they are all finished.
+	run := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan bool)
+		go func() {
+			s.Run(ctx)
+			close(done)
+		}()
+		Eventually(func() int {
+			counts := s.Status().Counts
+			return counts[StateQueued] + counts[StateClipping]
+		}).Should(Equal(0))
+		cancel()
+		<-done
+	}
+
+	It("Should queue URLs posted as JSON and report their status", func() {
+		res, err := http.Post(ts.URL+"/clip", "application/json", strings.NewReader(`{"url": "https://hbr.org/ai-ceos", "title": "AI CEOs", "tags": ["ai", "leadership"], "token": "s3cret"}`))
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		var j Job
+		decode(res, &j)
+		Expect(j.ID).To(Equal(1))
+		Expect(j.State).To(Equal(StateQueued))
+
+		run()
+		Expect(clipper.items).To(HaveLen(1))
+		Expect(clipper.items[0].Tags).To(Equal([]string{"ai", "leadership"}))
+
+		res, err = http.Get(ts.URL + "/status/1")
+		Expect(err).To(BeNil())
+		decode(res, &j)
+		Expect(j.State).To(Equal(StateDone))
+		Expect(j.Note).To(Equal("AI CEOs.md"))
+
+		res, err = http.Get(ts.URL + "/status/2")
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("Should clip the HTML posted by the bookmarklet", func() {
+		form := url.Values{"url": {"https://aws.amazon.com/istio"}, "title": {"Istio"}, "html": {"<html><body>Istio</body></html>"}, "tags": {"tech, k8s"}, "token": {"s3cret"}}
+		res, err := http.PostForm(ts.URL+"/clip", form)
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		body, _ := io.ReadAll(res.Body)
+		Expect(string(body)).To(ContainSubstring(`Clipping Istio, see <a href="/status/1">`))
+
+		run()
+		Expect(clipper.items[0].HTML).To(Equal("<html><body>Istio</body></html>"))
+		Expect(clipper.items[0].Tags).To(Equal([]string{"tech", "k8s"}))
+
+		Expect(Bookmarklet("http://127.0.0.1:8421/", "")).To(ContainSubstring(`f.action="http://127.0.0.1:8421/clip"`))
+		Expect(Bookmarklet("http://127.0.0.1:8421", "s3cret")).To(ContainSubstring(`['token',"s3cret"]`))
+		res, err = http.Get(ts.URL + "/")
+		Expect(err).To(BeNil())
+		body, _ = io.ReadAll(res.Body)
+		Expect(string(body)).To(ContainSubstring(`<a href="javascript:`))
+	})
+
+	It("Should report failures and duplicates", func() {
+		for _, u := range []string{"https://example.com/fail", "https://example.com/a", "https://example.com/a"} {
+			if s.Status().Counts[StateQueued] == 2 {
+				run()
+			}
+			res, err := http.PostForm(ts.URL+"/clip", url.Values{"url": {u}, "token": {"s3cret"}})
+			Expect(err).To(BeNil())
+			Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		}
+		run()
+		var status Status
+		res, err := http.Get(ts.URL + "/status")
+		Expect(err).To(BeNil())
+		decode(res, &status)
+		Expect(status.Counts).To(Equal(map[string]int{StateQueued: 0, StateClipping: 0, StateDone: 1, StateDuplicate: 1, StateFailed: 1}))
+		Expect(status.Jobs[0].State).To(Equal(StateDuplicate), "newest first")
+		Expect(status.Jobs[0].Error).To(ContainSubstring("https://example.com/a.md"))
+		Expect(status.Jobs[2].Error).To(Equal("error retrieving https://example.com/fail"))
+	})
+
+	It("Should reject bad requests", func() {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/clip", strings.NewReader("token=s3cret&url=ftp://example.com/"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+		var e map[string]string
+		decode(res, &e)
+		Expect(e["error"]).To(ContainSubstring("expected an http or https URL"))
+
+		res, err = http.PostForm(ts.URL+"/clip", url.Values{"url": {"https://example.com/"}})
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+		res, err = http.PostForm(ts.URL+"/clip?token=s3cret", url.Values{"url": {"https://example.com/"}})
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusForbidden), "the token isn't read from the URL")
+		res, err = http.PostForm(ts.URL+"/clip", url.Values{"url": {"https://example.com/"}, "token": {"s3cret"}})
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+
+		s.Add(source.URL("https://example.com/2", s.Now()))
+		res, err = http.PostForm(ts.URL+"/clip", url.Values{"url": {"https://example.com/3"}, "token": {"s3cret"}})
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusServiceUnavailable), "the queue is full")
+		Expect(s.Status().Jobs).To(HaveLen(2))
+	})
+
+	It("Should not clip cross-origin GET requests", func() {
+		// as made by an <img> or link on another web page
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/clip?token=s3cret&url="+url.QueryEscape("http://127.0.0.1:8080/admin"), nil)
+		req.Header.Set("Origin", "https://evil.example")
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(s.Status().Jobs).To(BeEmpty())
+	})
+
+	It("Should reject requests for a foreign host", func() {
+		s.Add(source.URL("https://example.com/private", s.Now()))
+		for _, path := range []string{"/", "/status", "/status/1"} {
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+			req.Host = "rebound.evil.example:8421"
+			res, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			Expect(res.StatusCode).To(Equal(http.StatusForbidden), path)
+			body, _ := io.ReadAll(res.Body)
+			Expect(string(body)).NotTo(ContainSubstring("s3cret"))
+			Expect(string(body)).NotTo(ContainSubstring("example.com/private"))
+		}
+
+		for _, host := range []string{"localhost:8421", "[::1]:8421", "127.0.0.1"} {
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/status", nil)
+			req.Host = host
+			res, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			Expect(res.StatusCode).To(Equal(http.StatusOK), host)
+		}
+		s.Hosts = []string{"clipper.lan"}
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/status", nil)
+		req.Host = "clipper.lan:8421"
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).To(BeNil())
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+	})
+})
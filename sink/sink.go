@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink is where notes are written: a vault directory, an archive or a stream.
+// Create is safe for concurrent use. Every file must be closed before the Sink is closed.
+type Sink interface {
+	// Create creates the file name, a slash separated path relative to the root of the output.
+	Create(name string) (io.WriteCloser, error)
+	// Close completes the output.
+	Close() error
+}
+
+// Stdout is the target of Open writing the notes to stdout.
+const Stdout = "-"
+
+// Open returns the Sink for target: Stdout, a .zip, .tar, .tar.gz or .tgz archive, otherwise a directory.
+func Open(target string) (Sink, error) {
+	if IsDir(target) {
+		return Dir(target), nil
+	}
+	if target == Stdout {
+		return NewConcat(os.Stdout), nil
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return nil, fmt.Errorf("error creating archive %s: %w", target, err)
+	}
+	lower := strings.ToLower(target)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return NewZip(file), nil
+	case strings.HasSuffix(lower, ".tar"):
+		return NewTar(file), nil
+	default:
+		gz := gzip.NewWriter(file)
+		return NewTar(&gzipFile{Writer: gz, file: file}), nil
+	}
+}
+
+// IsDir reports whether Open returns a Dir for target.
+func IsDir(target string) bool {
+	lower := strings.ToLower(target)
+	for _, suffix := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, suffix) {
+			return false
+		}
+	}
+	return target != Stdout
+}
+
+// Dir writes each note to a file below the directory, creating sub-directories as needed.
+type Dir string
+
+func (d Dir) Create(name string) (io.WriteCloser, error) {
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory for %s: %w", path, err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+func (d Dir) Close() error {
+	return nil
+}
+
+// bufferedFile holds a file in memory until it is closed, then it is added to the output in one go,
+// so files created concurrently don't interleave.
+type bufferedFile struct {
+	bytes.Buffer
+	close func(b []byte) error
+}
+
+func (f *bufferedFile) Close() error {
+	return f.close(f.Bytes())
+}
+
+// Zip writes the notes to a ZIP archive.
+type Zip struct {
+	mu  sync.Mutex
+	zw  *zip.Writer
+	out io.Closer
+}
+
+// NewZip writes a ZIP archive to w, which is closed with the Sink.
+func NewZip(w io.WriteCloser) *Zip {
+	return &Zip{zw: zip.NewWriter(w), out: w}
+}
+
+func (z *Zip) Create(name string) (io.WriteCloser, error) {
+	return &bufferedFile{close: func(b []byte) error {
+		z.mu.Lock()
+		defer z.mu.Unlock()
+		w, err := z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return fmt.Errorf("error adding %s to archive: %w", name, err)
+		}
+		_, err = w.Write(b)
+		return err
+	}}, nil
+}
+
+func (z *Zip) Close() error {
+	if err := z.zw.Close(); err != nil {
+		z.out.Close()
+		return fmt.Errorf("error completing archive: %w", err)
+	}
+	return z.out.Close()
+}
+
+// Tar writes the notes to a tar archive.
+type Tar struct {
+	mu  sync.Mutex
+	tw  *tar.Writer
+	out io.Closer
+}
+
+// NewTar writes a tar archive to w, which is closed with the Sink.
+func NewTar(w io.WriteCloser) *Tar {
+	return &Tar{tw: tar.NewWriter(w), out: w}
+}
+
+func (t *Tar) Create(name string) (io.WriteCloser, error) {
+	return &bufferedFile{close: func(b []byte) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if err := t.tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("error adding %s to archive: %w", name, err)
+		}
+		_, err := t.tw.Write(b)
+		return err
+	}}, nil
+}
+
+func (t *Tar) Close() error {
+	if err := t.tw.Close(); err != nil {
+		t.out.Close()
+		return fmt.Errorf("error completing archive: %w", err)
+	}
+	return t.out.Close()
+}
+
+// gzipFile compresses to a file, closing both.
+type gzipFile struct {
+	*gzip.Writer
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.file.Close()
+		return err
+	}
+	return g.file.Close()
+}
+
+// Concat writes the notes one after another to a stream, for piping into other tools.
+// Each note is written whole, ending with a newline.
+type Concat struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConcat writes the notes to w, which is not closed with the Sink.
+func NewConcat(w io.Writer) *Concat {
+	return &Concat{w: w}
+}
+
+func (c *Concat) Create(name string) (io.WriteCloser, error) {
+	return &bufferedFile{close: func(b []byte) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			b = append(b, '\n')
+		}
+		_, err := c.w.Write(b)
+		return err
+	}}, nil
+}
+
+func (c *Concat) Close() error {
+	return nil
+}
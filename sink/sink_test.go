@@ -0,0 +1,126 @@
+package sink
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSink(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "sink suite")
+}
+
+// writeNotes writes the notes concurrently, as the workers do.
+func writeNotes(s Sink, notes map[string]string) {
+	var wg sync.WaitGroup
+	for name, content := range notes {
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			w, err := s.Create(name)
+			Expect(err).To(BeNil())
+			_, err = io.WriteString(w, content)
+			Expect(err).To(BeNil())
+			Expect(w.Close()).To(Succeed())
+		}()
+	}
+	wg.Wait()
+	Expect(s.Close()).To(Succeed())
+}
+
+var _ = Describe("SinkTest", func() {
+
+	notes := map[string]string{}
+	for i := range 20 {
+		notes[fmt.Sprintf("Folder/Note %d.md", i)] = fmt.Sprintf("---\ntitle: Note %d\n---\n%s\n", i, strings.Repeat("text ", 100))
+	}
+
+	It("Should pick the sink from the target", func() {
+		Expect(IsDir("archive")).To(BeTrue())
+		Expect(IsDir("notes.ZIP")).To(BeFalse())
+		Expect(IsDir("notes.tar.gz")).To(BeFalse())
+		Expect(IsDir(Stdout)).To(BeFalse())
+		s, err := Open(Stdout)
+		Expect(err).To(BeNil())
+		Expect(s).To(BeAssignableToTypeOf(&Concat{}))
+	})
+
+	It("Should write notes to a directory", func() {
+		dir := filepath.Join(GinkgoT().TempDir(), "vault")
+		s, err := Open(dir)
+		Expect(err).To(BeNil())
+		writeNotes(s, notes)
+		b, err := os.ReadFile(filepath.Join(dir, "Folder", "Note 3.md"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal(notes["Folder/Note 3.md"]))
+	})
+
+	It("Should write notes to a ZIP", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "notes.zip")
+		s, err := Open(path)
+		Expect(err).To(BeNil())
+		writeNotes(s, notes)
+
+		z, err := zip.OpenReader(path)
+		Expect(err).To(BeNil())
+		defer z.Close()
+		Expect(z.File).To(HaveLen(len(notes)))
+		for _, f := range z.File {
+			r, err := f.Open()
+			Expect(err).To(BeNil())
+			b, err := io.ReadAll(r)
+			r.Close()
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal(notes[f.Name]))
+		}
+	})
+
+	It("Should write notes to a compressed tar", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "notes.tgz")
+		s, err := Open(path)
+		Expect(err).To(BeNil())
+		writeNotes(s, notes)
+
+		f, err := os.Open(path)
+		Expect(err).To(BeNil())
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		Expect(err).To(BeNil())
+		tr := tar.NewReader(gz)
+		found := 0
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).To(BeNil())
+			b, err := io.ReadAll(tr)
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(Equal(notes[h.Name]))
+			found++
+		}
+		Expect(found).To(Equal(len(notes)))
+	})
+
+	It("Should concatenate whole notes", func() {
+		var b bytes.Buffer
+		writeNotes(NewConcat(&b), map[string]string{"A.md": "---\ntitle: A\n---\nA", "B.md": "---\ntitle: B\n---\nB\n"})
+		Expect(b.String()).To(Or(
+			Equal("---\ntitle: A\n---\nA\n---\ntitle: B\n---\nB\n"),
+			Equal("---\ntitle: B\n---\nB\n---\ntitle: A\n---\nA\n"),
+		))
+	})
+})
@@ -0,0 +1,226 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// GeneratedKind is the vault.KindKey of the site notes.
+const GeneratedKind = "site"
+
+// Site is a website clippings were saved from, written as a note listing them.
+type Site struct {
+	Name        string       `yaml:"site"`
+	Domain      string       `yaml:"domain"`
+	URL         string       `yaml:"url"`
+	Favicon     string       `yaml:"favicon,omitempty"`
+	Description string       `yaml:"description,omitempty"`
+	Notes       []vault.Note `yaml:"-"`
+}
+
+// frontmatter is the frontmatter of a site note.
+type frontmatter struct {
+	GeneratedBy   string `yaml:"generated_by"`
+	GeneratedKind string `yaml:"generated_kind"`
+	Site          `yaml:",inline"`
+	Count         int `yaml:"count"`
+}
+
+// Name returns the name in a site property, which may be a wikilink to the site's note.
+func Name(property string) string {
+	name := strings.TrimSpace(property)
+	if strings.HasPrefix(name, "[[") && strings.HasSuffix(name, "]]") {
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "[["), "]]")
+		if i := strings.LastIndex(name, "|"); i >= 0 {
+			name = name[i+1:]
+		} else {
+			name = name[strings.LastIndex(name, "/")+1:]
+		}
+	}
+	return name
+}
+
+// Build returns the sites of the notes by domain, sorted by domain, with their notes newest first.
+// A site is named by the site property most of its notes have, or its domain.
+func Build(notes []vault.Note) []*Site {
+	byDomain := map[string]*Site{}
+	names := map[string]map[string]int{}
+	for _, n := range notes {
+		md := n.Clipping.Metadata
+		domain := md.Domain
+		if domain == "" {
+			domain = canonical.Domain(md.Source)
+		}
+		domain = clean(domain)
+		if domain == "" {
+			continue
+		}
+		s, ok := byDomain[domain]
+		if !ok {
+			s = &Site{Domain: domain, URL: "https://" + domain + "/"}
+			if u, err := nurl.Parse(md.Source); err == nil && u.Host != "" {
+				s.URL = u.Scheme + "://" + u.Host + "/" // the home page
+			}
+			byDomain[domain] = s
+			names[domain] = map[string]int{}
+		}
+		s.Notes = append(s.Notes, n)
+		if name := Name(md.Site); name != "" {
+			names[domain][name]++
+		}
+	}
+	sites := make([]*Site, 0, len(byDomain))
+	for domain, s := range byDomain {
+		s.Name = domain
+		best := 0
+		for name, count := range names[domain] {
+			if count > best || (count == best && name < s.Name) {
+				s.Name, best = name, count
+			}
+		}
+		sort.SliceStable(s.Notes, func(i, j int) bool {
+			a, b := s.Notes[i].Clipping.Metadata, s.Notes[j].Clipping.Metadata
+			if a.Created != b.Created {
+				return a.Created > b.Created // newest first
+			}
+			return a.Title < b.Title
+		})
+		sites = append(sites, s)
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].Domain < sites[j].Domain })
+	return sites
+}
+
+// Path returns the path of the note of the site at domain, relative to the folder of the site notes.
+func Path(domain string) string {
+	return clean(domain) + ".md"
+}
+
+// clean makes a domain safe as a filename.
+func clean(domain string) string {
+	return strings.Trim(strings.NewReplacer("\\", "-", ":", "-", "/", "-").Replace(domain), ". ")
+}
+
+// Read reads the details of the site note at path, written by Markdown.
+func Read(path string) (*Site, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parts := bytes.SplitN(b, page.ByteDelimiter, 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("site note %s has no frontmatter", path)
+	}
+	var f frontmatter
+	if err := yaml.Unmarshal(parts[1], &f); err != nil {
+		return nil, fmt.Errorf("error reading site note %s: %w", path, err)
+	}
+	return &f.Site, nil
+}
+
+// Describe sets the name, description and favicon of the site from the HTML of its home page, where it has them.
+func (s *Site) Describe(content []byte) error {
+	doc, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("error parsing home page of %s: %w", s.Domain, err)
+	}
+	base, err := nurl.Parse(s.URL)
+	if err != nil {
+		return fmt.Errorf("error parsing site URL %s: %w", s.URL, err)
+	}
+	var name, description, favicon string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "body" {
+			return
+		}
+		if n.Type == html.ElementNode {
+			attrs := map[string]string{}
+			for _, a := range n.Attr {
+				attrs[strings.ToLower(a.Key)] = strings.TrimSpace(a.Val)
+			}
+			switch n.Data {
+			case "meta":
+				key := strings.ToLower(attrs["property"] + attrs["name"])
+				switch {
+				case key == "og:site_name" || (key == "application-name" && name == ""):
+					name = attrs["content"]
+				case key == "og:description" || (key == "description" && description == ""):
+					description = attrs["content"]
+				}
+			case "link":
+				rel := " " + strings.ToLower(attrs["rel"]) + " "
+				if strings.Contains(rel, " icon ") && favicon == "" && attrs["href"] != "" {
+					if ref, err := base.Parse(attrs["href"]); err == nil {
+						favicon = ref.String()
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if name != "" {
+		s.Name = name
+	}
+	if description != "" {
+		s.Description = strings.Join(strings.Fields(description), " ")
+	}
+	if favicon != "" {
+		s.Favicon = favicon
+	}
+	return nil
+}
+
+// Markdown returns the note, to be written to from: the site's details and each of its clippings as a link
+// with its read state and date, as a checked item if it has been read.
+func (s *Site) Markdown(l vault.Links, from string) []byte {
+	var b strings.Builder
+	b.WriteString("---\n")
+	f, _ := yaml.Marshal(frontmatter{GeneratedBy: vault.GeneratedBy, GeneratedKind: GeneratedKind, Site: *s, Count: len(s.Notes)})
+	b.Write(f)
+	b.WriteString("---\n# ")
+	if s.Favicon != "" {
+		fmt.Fprintf(&b, "![icon|16](%s) ", s.Favicon)
+	}
+	fmt.Fprintf(&b, "%s\n\n[%s](%s)\n\n", s.Name, s.Domain, s.URL)
+	if s.Description != "" {
+		fmt.Fprintf(&b, "> %s\n\n", s.Description)
+	}
+	b.WriteString(vault.GeneratedNotice + "\n\n## Clippings\n\n")
+	for _, n := range s.Notes {
+		md := n.Clipping.Metadata
+		check := " "
+		if md.Read {
+			check = "x"
+		}
+		fmt.Fprintf(&b, "- [%s] %s", check, l.Link(from, n.Path, md.Title))
+		if len(md.Created) >= len("2006-01-02") {
+			fmt.Fprintf(&b, " (%s)", md.Created[:len("2006-01-02")])
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// Paths returns the paths the site notes are written to below dir, as a set for vault.RemoveStale.
+func Paths(dir string, sites []*Site) map[string]bool {
+	paths := map[string]bool{}
+	for _, s := range sites {
+		paths[filepath.Join(dir, Path(s.Domain))] = true
+	}
+	return paths
+}
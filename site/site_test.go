@@ -0,0 +1,93 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+	"github.com/fergalsomers/pocket-obsidian/vault/vaulttest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "site suite")
+}
+
+const homePage = `<html><head>
+<meta property="og:site_name" content="Harvard Business Review">
+<meta name="description" content="Ideas and advice
+  for leaders">
+<link rel="shortcut icon" href="/favicon-32.png">
+</head><body><meta name="description" content="not in the head"></body></html>`
+
+var _ = Describe("SiteTest", func() {
+
+	notes := []vault.Note{
+		vaulttest.Note("AI CEOs.md", page.ClippingMetadata{Title: "AI CEOs", Source: "https://www.hbr.org/ai-ceos", Created: "2025-05-22T10:04:05", Site: "[[Sites/hbr.org|HBR]]", Read: true}),
+		vaulttest.Note("Aperture.md", page.ClippingMetadata{Title: "Aperture", Source: "https://hbr.org/aperture", Domain: "hbr.org", Created: "2023-09-20", Site: "HBR"}),
+		vaulttest.Note("Old.md", page.ClippingMetadata{Title: "Old", Source: "https://hbr.org/old", Created: "2020-01-01"}),
+		vaulttest.Note("Tech/Istio.md", page.ClippingMetadata{Title: "Istio", Source: "http://aws.amazon.com:8080/istio", Created: "2025-05-16"}),
+	}
+
+	It("Should group the notes by site", func() {
+		sites := Build(notes)
+		Expect(sites).To(HaveLen(2))
+		Expect(sites[0].Domain).To(Equal("aws.amazon.com"))
+		Expect(sites[0].Name).To(Equal("aws.amazon.com"))
+		Expect(sites[0].URL).To(Equal("http://aws.amazon.com:8080/"))
+		Expect(sites[1].Name).To(Equal("HBR"), "the most common site property")
+		Expect(sites[1].URL).To(Equal("https://www.hbr.org/"), "from its clippings")
+		Expect(sites[1].Notes).To(HaveLen(3))
+		Expect(Paths("Sites", sites)).To(HaveKey(filepath.Join("Sites", "hbr.org.md")))
+		Expect(Name("[[Sites/hbr.org]]")).To(Equal("hbr.org"))
+	})
+
+	It("Should describe the site from its home page", func() {
+		s := Build(notes)[1]
+		Expect(s.Describe([]byte(homePage))).To(Succeed())
+		Expect(s.Name).To(Equal("Harvard Business Review"))
+		Expect(s.Description).To(Equal("Ideas and advice for leaders"))
+		Expect(s.Favicon).To(Equal("https://www.hbr.org/favicon-32.png"))
+	})
+
+	It("Should write a note listing the clippings", func() {
+		s := Build(notes)[1]
+		s.Favicon, s.Description = "https://hbr.org/favicon.ico", "Ideas"
+		Expect(string(s.Markdown(vault.Links{Root: vaulttest.Root}, "vault/Sites/hbr.org.md"))).To(Equal(`---
+generated_by: pocket-obsidian
+generated_kind: site
+site: HBR
+domain: hbr.org
+url: https://www.hbr.org/
+favicon: https://hbr.org/favicon.ico
+description: Ideas
+count: 3
+---
+# ![icon|16](https://hbr.org/favicon.ico) HBR
+
+[hbr.org](https://www.hbr.org/)
+
+> Ideas
+
+_Generated by pocket-obsidian, changes are overwritten._
+
+## Clippings
+
+- [x] [[AI CEOs]] (2025-05-22)
+- [ ] [[Aperture]] (2023-09-20)
+- [ ] [[Old]] (2020-01-01)
+`))
+
+		path := filepath.Join(GinkgoT().TempDir(), "hbr.org.md")
+		Expect(os.WriteFile(path, s.Markdown(vault.Links{Root: vaulttest.Root}, path), 0644)).To(Succeed())
+		read, err := Read(path)
+		Expect(err).To(BeNil())
+		Expect(*read).To(Equal(Site{Name: "HBR", Domain: "hbr.org", URL: "https://www.hbr.org/", Favicon: "https://hbr.org/favicon.ico", Description: "Ideas"}))
+		Expect(vault.Generated(path)).To(BeTrue())
+	})
+})
@@ -0,0 +1,165 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+	"github.com/fergalsomers/pocket-obsidian/csv"
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"golang.org/x/net/html"
+)
+
+// ManifestName is the optional file in a snapshot directory mapping URLs to the snapshot of the page,
+// a JSON object such as {"https://example.com/article": "article.html"}. Paths are relative to the directory.
+const ManifestName = "manifest.json"
+
+// Comments left at the top of saved pages recording where they were saved from.
+var (
+	savedFrom  = regexp.MustCompile(`saved from url=\(\d+\)(\S+)`) // Chrome and Internet Explorer "Save Page As"
+	singleFile = regexp.MustCompile(`(?m)^\s*url: (\S+)`)          // SingleFile
+)
+
+// Dir is a page.ContentRetriever serving pages from HTML snapshots saved in a directory,
+// such as SingleFile or "Save Page As" files. Pages without a snapshot are retrieved from next.
+type Dir struct {
+	files map[string]string // snapshot file by canonical.Key of the URL
+	next  page.ContentRetriever
+}
+
+// Open indexes the snapshots in dir by URL, using the manifest if there is one,
+// otherwise the saved-from comment, canonical link or og:url in each .html file.
+// Pages without a snapshot are retrieved from next, or are an error if it is nil.
+func Open(dir string, next page.ContentRetriever) (*Dir, error) {
+	d := &Dir{files: map[string]string{}, next: next}
+	b, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	switch {
+	case err == nil:
+		manifest := map[string]string{}
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, ManifestName), err)
+		}
+		for url, file := range manifest {
+			d.files[canonical.Key(url)] = filepath.Join(dir, filepath.FromSlash(file))
+		}
+		return d, nil
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read snapshot manifest: %w", err)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if e.IsDir() || (ext != ".html" && ext != ".htm") {
+			return nil
+		}
+		urls, err := readURLs(path)
+		if err != nil {
+			return err
+		}
+		for _, url := range urls {
+			if !csv.IsURL(url) {
+				continue // a relative canonical link
+			}
+			if key := canonical.Key(url); d.files[key] == "" {
+				d.files[key] = path
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index snapshots in %s: %w", dir, err)
+	}
+	return d, nil
+}
+
+// Len returns the number of URLs with a snapshot.
+func (d *Dir) Len() int {
+	return len(d.files)
+}
+
+// Get returns the snapshot of url, or retrieves it from next if there is none.
+func (d *Dir) Get(url string) ([]byte, string, error) {
+	file, ok := d.files[canonical.Key(url)]
+	if !ok {
+		if d.next == nil {
+			return nil, "", fmt.Errorf("no snapshot of %s", url)
+		}
+		return d.next.Get(url)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading snapshot of %s: %w", url, err)
+	}
+	return content, "text/html", nil
+}
+
+// GetResource retrieves a resource of a page, such as an image, from next. Snapshots hold pages only.
+func (d *Dir) GetResource(url string) ([]byte, string, error) {
+	if r, ok := d.next.(page.ResourceRetriever); ok {
+		return r.GetResource(url)
+	}
+	return nil, "", fmt.Errorf("no snapshot of %s", url)
+}
+
+// readURLs returns the URLs a snapshot was saved from, read from the document up to the <body>.
+func readURLs(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return headURLs(file)
+}
+
+func headURLs(r io.Reader) ([]string, error) {
+	urls := []string{}
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return urls, nil
+			}
+			return nil, z.Err()
+		case html.CommentToken:
+			comment := string(z.Text())
+			for _, re := range []*regexp.Regexp{savedFrom, singleFile} {
+				if m := re.FindStringSubmatch(comment); m != nil {
+					urls = append(urls, m[1])
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) == "body" {
+				return urls, nil
+			}
+			if !hasAttr || (string(name) != "link" && string(name) != "meta") {
+				continue
+			}
+			attrs := map[string]string{}
+			for {
+				key, val, more := z.TagAttr()
+				attrs[strings.ToLower(string(key))] = strings.TrimSpace(string(val))
+				if !more {
+					break
+				}
+			}
+			switch {
+			case strings.EqualFold(attrs["rel"], "canonical") && attrs["href"] != "":
+				urls = append(urls, attrs["href"])
+			case attrs["property"] == "og:url" && attrs["content"] != "":
+				urls = append(urls, attrs["content"])
+			}
+		}
+	}
+}
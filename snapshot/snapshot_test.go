@@ -0,0 +1,74 @@
+package snapshot
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSnapshot(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "snapshot suite")
+}
+
+// network records the URLs that would have been retrieved.
+type network struct {
+	urls []string
+}
+
+func (n *network) Get(url string) ([]byte, string, error) {
+	n.urls = append(n.urls, url)
+	return nil, "", fmt.Errorf("404 : Not Found")
+}
+
+var _ = Describe("SnapshotTest", func() {
+
+	It("Should index snapshots by the URL they were saved from", func() {
+		next := &network{}
+		d, err := Open(filepath.Join("testdata", "saved"), next)
+		Expect(err).To(BeNil())
+		Expect(d.Len()).To(Equal(4))
+
+		for url, expected := range map[string]string{
+			"https://www.updatecli.io/docs/prologue/introduction/":                         "Updatecli is a tool",
+			"http://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos?utm_source=pocket": "Saved from the browser.",
+			"https://digital-photography-school.com/aperture":                              "The aperture is the opening",
+			"https://digital-photography-school.com/aperture/?amp=1":                       "The aperture is the opening",
+		} {
+			content, contentType, err := d.Get(url)
+			Expect(err).To(BeNil(), url)
+			Expect(contentType).To(Equal("text/html"))
+			Expect(string(content)).To(ContainSubstring(expected), url)
+		}
+		Expect(next.urls).To(BeEmpty())
+
+		_, _, err = d.Get("https://example.com/not-in-the-head")
+		Expect(err).NotTo(BeNil())
+		Expect(next.urls).To(Equal([]string{"https://example.com/not-in-the-head"}))
+	})
+
+	It("Should use the manifest", func() {
+		d, err := Open(filepath.Join("testdata", "manifest"), nil)
+		Expect(err).To(BeNil())
+		Expect(d.Len()).To(Equal(1))
+		content, _, err := d.Get("https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos")
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(ContainSubstring("Saved from the browser."))
+		_, _, err = d.Get("https://www.updatecli.io/docs/prologue/introduction/")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Should convert snapshots to clippings", func() {
+		d, err := Open(filepath.Join("testdata", "saved"), nil)
+		Expect(err).To(BeNil())
+		c, err := page.PageToClipping(d, &page.Page{Title: "x", Url: "https://www.updatecli.io/docs/prologue/introduction/"})
+		Expect(err).To(BeNil())
+		Expect(c.Metadata.Title).To(Equal("Introduction - Updatecli"))
+		Expect(string(c.MarkdownContent)).To(ContainSubstring("Updatecli is a tool used to apply file update strategies."))
+	})
+})
@@ -0,0 +1,140 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/csv"
+	"golang.org/x/net/html"
+)
+
+// BookmarksDoctype starts a Netscape bookmark file, as exported by browsers, Pinboard, Raindrop and others.
+const BookmarksDoctype = "<!DOCTYPE NETSCAPE-BOOKMARK-FILE-1>"
+
+// ReadBookmarks reads a Netscape bookmark file.
+// The TAGS attribute of a bookmark gives its tags. The folders (<H3>) it is nested in form a / separated
+// folder path, which is added as a (nested) tag if folderAsTag, otherwise it is the folder of the item.
+// Bookmarks without an ADD_DATE are added now.
+func ReadBookmarks(path string, folderAsTag bool, now time.Time) ([]*Item, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bookmarks file: %w", err)
+	}
+	defer file.Close()
+	return readBookmarks(file, folderAsTag, now)
+}
+
+func readBookmarks(r io.Reader, folderAsTag bool, now time.Time) ([]*Item, error) {
+	items := []*Item{}
+
+	folders := []string{} // the folders the tokenizer is currently in
+	pendingFolder := ""   // the last <H3> seen, it applies to the next <DL>
+	var bookmark *Item    // the item of the <A> being read
+	inFolderName := false // reading the text of an <H3>
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return items, nil
+			}
+			return nil, fmt.Errorf("failed to parse bookmarks: %w", z.Err())
+
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "h3":
+				inFolderName = true
+				pendingFolder = ""
+			case "dl":
+				folders = append(folders, pendingFolder)
+				pendingFolder = ""
+			case "a":
+				attrs := tokenAttrs(z)
+				if !csv.IsURL(attrs["href"]) {
+					continue // bookmarklets, place: queries and the like
+				}
+				bookmark = &Item{URL: attrs["href"], Added: bookmarkTime(attrs["add_date"], now), Tags: []string{}}
+				for _, t := range strings.Split(attrs["tags"], ",") {
+					if t = strings.TrimSpace(t); t != "" {
+						bookmark.Tags = append(bookmark.Tags, t)
+					}
+				}
+				if folder := folderPath(folders); folder != "" {
+					if folderAsTag {
+						bookmark.Tags = append(bookmark.Tags, folder)
+					} else {
+						bookmark.Folder = folder
+					}
+				}
+			}
+
+		case html.TextToken:
+			text := strings.TrimSpace(string(z.Text()))
+			switch {
+			case inFolderName:
+				pendingFolder += text
+			case bookmark != nil:
+				bookmark.Title += text
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "h3":
+				inFolderName = false
+			case "dl":
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			case "a":
+				if bookmark != nil {
+					if bookmark.Title == "" {
+						bookmark.Title = bookmark.URL
+					}
+					items = append(items, bookmark)
+					bookmark = nil
+				}
+			}
+		}
+	}
+}
+
+// tokenAttrs returns the attributes of the current tag, the keys are lower case.
+func tokenAttrs(z *html.Tokenizer) map[string]string {
+	attrs := map[string]string{}
+	for {
+		key, val, more := z.TagAttr()
+		attrs[strings.ToLower(string(key))] = string(val)
+		if !more {
+			return attrs
+		}
+	}
+}
+
+// bookmarkTime converts an ADD_DATE, in unix seconds. Some exporters use milli or microseconds.
+func bookmarkTime(addDate string, now time.Time) time.Time {
+	t, err := strconv.ParseInt(strings.TrimSpace(addDate), 10, 64)
+	if err != nil || t <= 0 {
+		return now
+	}
+	for t > 100_000_000_000 { // later than the year 5000, so not seconds
+		t /= 1000
+	}
+	return time.Unix(t, 0)
+}
+
+// folderPath joins the names of the folders, ignoring the unnamed top level list.
+func folderPath(folders []string) string {
+	names := []string{}
+	for _, f := range folders {
+		if f != "" {
+			names = append(names, strings.ReplaceAll(f, "/", "-"))
+		}
+	}
+	return strings.Join(names, "/")
+}
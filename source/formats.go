@@ -0,0 +1,93 @@
+package source
+
+import (
+	"bytes"
+
+	"github.com/fergalsomers/pocket-obsidian/csv"
+)
+
+// The built in formats. Omnivore is sniffed before Pocket as both are ZIPs or directories.
+func init() {
+	Register(Format{
+		Name: "omnivore",
+		Sniff: func(p *Probe) bool {
+			keys := p.JSONKeys()
+			return p.Glob("metadata_*.json") || (keys["slug"] && keys["savedAt"])
+		},
+		Open: func(path string, o Options) (Source, error) {
+			return items(ReadOmnivore(path, o.Now))
+		},
+	})
+	Register(Format{
+		Name: "pocket",
+		Sniff: func(p *Probe) bool {
+			return p.FS != nil || csv.HasHeader(p.CSVHeader(), csv.PocketHeader)
+		},
+		Open: openPocket,
+	})
+	Register(Format{
+		Name: "instapaper",
+		Sniff: func(p *Probe) bool {
+			return csv.HasHeader(p.CSVHeader(), csv.InstapaperHeader)
+		},
+		Open: func(path string, o Options) (Source, error) {
+			return ReadInstapaper(path, o.FolderAsTag)
+		},
+	})
+	Register(Format{
+		Name: "bookmarks",
+		Sniff: func(p *Probe) bool {
+			return bytes.Contains(bytes.ToUpper(p.Head), []byte(BookmarksDoctype))
+		},
+		Open: func(path string, o Options) (Source, error) {
+			return items(ReadBookmarks(path, o.FolderAsTag, o.Now))
+		},
+	})
+	Register(Format{
+		Name: "wallabag",
+		Sniff: func(p *Probe) bool {
+			keys := p.JSONKeys()
+			return keys["is_archived"] && (keys["is_starred"] || keys["content"])
+		},
+		Open: func(path string, o Options) (Source, error) {
+			return items(ReadWallabag(path, o.Now))
+		},
+	})
+	Register(Format{
+		Name: "readeck",
+		Sniff: func(p *Probe) bool {
+			keys := p.JSONKeys()
+			return keys["is_marked"] && (keys["has_article"] || keys["read_progress"])
+		},
+		Open: func(path string, o Options) (Source, error) {
+			return items(ReadReadeck(path, o.Now))
+		},
+	})
+}
+
+func items(items []*Item, err error) (Source, error) {
+	if err != nil {
+		return nil, err
+	}
+	return Items(items...), nil
+}
+
+// PocketSource is a Pocket export, read from one or more CSV parts.
+type PocketSource struct {
+	Source
+	Parts     []csv.Part
+	Annotated int // the number of articles with highlights
+}
+
+// openPocket reads a Pocket export ZIP, directory or CSV file, with the highlights from its annotations.
+func openPocket(path string, o Options) (Source, error) {
+	records, parts, err := csv.ReadExport(path)
+	if err != nil {
+		return nil, err
+	}
+	highlights, err := csv.ReadAnnotations(path)
+	if err != nil {
+		return nil, err
+	}
+	return &PocketSource{Source: Records(records, highlights), Parts: parts, Annotated: len(highlights)}, nil
+}
@@ -0,0 +1,66 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/csv"
+	"github.com/fergalsomers/pocket-obsidian/page"
+)
+
+// Instapaper folders which are a read status rather than a folder.
+const (
+	instapaperUnread  = "Unread"
+	instapaperArchive = "Archive"
+)
+
+// instapaperSource yields the items of the rows of an Instapaper export.
+type instapaperSource struct {
+	rows        [][]string
+	folderAsTag bool
+}
+
+// ReadInstapaper reads an Instapaper export CSV.
+// Articles in the Archive folder are read. Articles in other folders (except Unread) are given the folder
+// name as a tag if folderAsTag, otherwise it is the folder of the item. A selection becomes a highlight.
+func ReadInstapaper(path string, folderAsTag bool) (Source, error) {
+	rows, err := csv.ReadInstapaper(path)
+	if err != nil {
+		return nil, err
+	}
+	return &instapaperSource{rows: rows, folderAsTag: folderAsTag}, nil
+}
+
+func (s *instapaperSource) Next() (*Item, error) {
+	if len(s.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := s.rows[0]
+	s.rows = s.rows[1:]
+	url, title, selection, folder, timestamp := row[0], row[1], row[2], row[3], row[4]
+	added, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, &RecordError{
+			Record: []string{title, url, timestamp, "", "unread"},
+			Err:    fmt.Errorf("error parsing Timestamp [%s]: %w", timestamp, err),
+		}
+	}
+	item := newItem(title, url, time.Unix(added, 0), nil, false)
+	switch folder {
+	case instapaperUnread, "":
+	case instapaperArchive:
+		item.Read = true
+	default:
+		if s.folderAsTag {
+			item.Tags = append(item.Tags, folder)
+		} else {
+			item.Folder = folder
+		}
+	}
+	if selection != "" {
+		item.Highlights = append(item.Highlights, page.Highlight{Quote: selection, CreatedAt: added})
+	}
+	return item, nil
+}
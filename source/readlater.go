@@ -0,0 +1,232 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/csv"
+	"github.com/fergalsomers/pocket-obsidian/page"
+)
+
+// Read-later services whose JSON exports include the stored article.
+
+// flexBool is a JSON boolean that may also be written as 0/1.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// flexTags is a list of tags written as strings or as objects with a label.
+type flexTags []string
+
+func (t *flexTags) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for _, r := range raw {
+		var s string
+		if err := json.Unmarshal(r, &s); err == nil {
+			*t = append(*t, s)
+			continue
+		}
+		var o struct {
+			Label string `json:"label"`
+			Name  string `json:"name"`
+		}
+		if err := json.Unmarshal(r, &o); err != nil {
+			return err
+		}
+		if o.Label != "" {
+			*t = append(*t, o.Label)
+		} else {
+			*t = append(*t, o.Name)
+		}
+	}
+	return nil
+}
+
+// exportTimeLayouts are the timestamp formats used by the exports.
+var exportTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05-0700", time.DateTime, time.DateOnly}
+
+// exportTime parses an export timestamp. Unknown times are now.
+func exportTime(s string, now time.Time) time.Time {
+	for _, layout := range exportTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Unix(t.Unix(), 0)
+		}
+	}
+	return now
+}
+
+// newItem returns the item of an exported article, titled by its URL if it has no title.
+func newItem(title string, url string, added time.Time, tags []string, read bool) *Item {
+	if title == "" {
+		title = url
+	}
+	return &Item{URL: url, Title: title, Added: added, Tags: append([]string{}, tags...), Read: read}
+}
+
+type wallabagEntry struct {
+	Title       string   `json:"title"`
+	URL         string   `json:"url"`
+	Content     string   `json:"content"`
+	IsArchived  flexBool `json:"is_archived"`
+	IsStarred   flexBool `json:"is_starred"`
+	Tags        flexTags `json:"tags"`
+	CreatedAt   string   `json:"created_at"`
+	Annotations []struct {
+		Quote     string `json:"quote"`
+		CreatedAt string `json:"created_at"`
+	} `json:"annotations"`
+}
+
+// ReadWallabag reads a wallabag JSON export.
+func ReadWallabag(path string, now time.Time) ([]*Item, error) {
+	var entries []wallabagEntry
+	if err := readJSON(path, &entries); err != nil {
+		return nil, err
+	}
+	items := []*Item{}
+	for _, e := range entries {
+		item := newItem(e.Title, e.URL, exportTime(e.CreatedAt, now), e.Tags, bool(e.IsArchived))
+		item.Starred = bool(e.IsStarred)
+		item.HTML = e.Content
+		for _, a := range e.Annotations {
+			item.Highlights = append(item.Highlights, page.Highlight{Quote: a.Quote, CreatedAt: exportTime(a.CreatedAt, now).Unix()})
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+type readeckBookmark struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	URL        string   `json:"url"`
+	Created    string   `json:"created"`
+	Labels     flexTags `json:"labels"`
+	IsArchived bool     `json:"is_archived"`
+	IsMarked   bool     `json:"is_marked"`
+	HasArticle bool     `json:"has_article"`
+}
+
+// ReadReadeck reads a Readeck JSON list of bookmarks (as returned by its /api/bookmarks).
+// The list doesn't include the article, it is read from <id>.html alongside the list (as returned by
+// /api/bookmarks/<id>/article) when present, otherwise the page is retrieved as for Pocket.
+func ReadReadeck(path string, now time.Time) ([]*Item, error) {
+	var bookmarks []readeckBookmark
+	if err := readJSON(path, &bookmarks); err != nil {
+		return nil, err
+	}
+	dir := os.DirFS(filepath.Dir(path))
+	items := []*Item{}
+	for _, b := range bookmarks {
+		item := newItem(b.Title, b.URL, exportTime(b.Created, now), b.Labels, b.IsArchived)
+		item.Starred = b.IsMarked
+		if b.HasArticle && b.ID != "" {
+			if content, err := fs.ReadFile(dir, b.ID+".html"); err == nil {
+				item.HTML = string(content)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+type omnivoreItem struct {
+	Slug       string   `json:"slug"`
+	Title      string   `json:"title"`
+	URL        string   `json:"url"`
+	State      string   `json:"state"`
+	Labels     flexTags `json:"labels"`
+	SavedAt    string   `json:"savedAt"`
+	Highlights []struct {
+		Quote     string `json:"quote"`
+		CreatedAt string `json:"createdAt"`
+		UpdatedAt string `json:"updatedAt"`
+	} `json:"highlights"`
+}
+
+// ReadOmnivore reads an Omnivore export: the ZIP, the directory it was extracted to or a single metadata_*.json.
+// The stored article of each item is read from content/<slug>.html, when present.
+func ReadOmnivore(exportPath string, now time.Time) ([]*Item, error) {
+	fsys, closer, err := csv.OpenArchive(exportPath)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	if fsys == nil {
+		fsys = os.DirFS(filepath.Dir(exportPath))
+		names = append(names, filepath.Base(exportPath))
+	} else {
+		defer closer.Close()
+		if names, err = fs.Glob(fsys, "metadata_*.json"); err != nil {
+			return nil, err
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s contains no metadata_*.json files", exportPath)
+	}
+
+	items := []*Item{}
+	for _, name := range names {
+		var exported []omnivoreItem
+		if err := readJSONFS(fsys, name, &exported); err != nil {
+			return nil, err
+		}
+		for _, o := range exported {
+			item := newItem(o.Title, o.URL, exportTime(o.SavedAt, now), o.Labels, strings.EqualFold(o.State, "Archived"))
+			for _, h := range o.Highlights {
+				created := h.CreatedAt
+				if created == "" {
+					created = h.UpdatedAt
+				}
+				item.Highlights = append(item.Highlights, page.Highlight{Quote: h.Quote, CreatedAt: exportTime(created, now).Unix()})
+			}
+			if o.Slug != "" {
+				if content, err := fs.ReadFile(fsys, path.Join("content", o.Slug+".html")); err == nil {
+					item.HTML = string(content)
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func readJSON(path string, v any) error {
+	return readJSONFS(os.DirFS(filepath.Dir(path)), filepath.Base(path), v)
+}
+
+func readJSONFS(fsys fs.FS, name string, v any) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open JSON file: %w", err)
+	}
+	defer file.Close()
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
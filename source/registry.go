@@ -0,0 +1,185 @@
+package source
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/csv"
+)
+
+// Auto is the format name that detects the format of each input from its content.
+const Auto = "auto"
+
+// Options are the settings shared by every format.
+type Options struct {
+	FolderAsTag bool      // add the folders of an item as a (nested) tag, rather than setting its Folder
+	Now         time.Time // when items without an added time were added
+}
+
+// Format is an input format: how to recognise it and how to read it.
+type Format struct {
+	Name  string
+	Sniff func(p *Probe) bool // reports whether the input is in this format
+	Open  func(path string, o Options) (Source, error)
+}
+
+// formats are the registered formats, sniffed in registration order.
+var formats = []Format{}
+
+// Register adds a format, it panics if the name is already registered.
+// Formats are sniffed in the order they are registered, so register more specific formats first.
+// Register is not safe for concurrent use, call it from init.
+func Register(f Format) {
+	if f.Name == Auto || lookup(f.Name) != nil {
+		panic("source: format " + f.Name + " is already registered")
+	}
+	formats = append(formats, f)
+}
+
+// Formats returns the names of the registered formats, starting with Auto.
+func Formats() []string {
+	names := []string{Auto}
+	for _, f := range formats {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func lookup(name string) *Format {
+	for i := range formats {
+		if formats[i].Name == name {
+			return &formats[i]
+		}
+	}
+	return nil
+}
+
+// Detect works out the format of an input (a file, ZIP or directory) from its content.
+func Detect(path string) (string, error) {
+	p, err := newProbe(path)
+	if err != nil {
+		return "", err
+	}
+	defer p.close()
+	for _, f := range formats {
+		if f.Sniff != nil && f.Sniff(p) {
+			return f.Name, nil
+		}
+	}
+	return "", fmt.Errorf("unrecognised input format of %s", path)
+}
+
+// Open opens the input in the named format, detecting it if the name is Auto. Returns the format used.
+func Open(path string, name string, o Options) (Source, string, error) {
+	if name == Auto {
+		var err error
+		if name, err = Detect(path); err != nil {
+			return nil, "", err
+		}
+	}
+	f := lookup(name)
+	if f == nil {
+		return nil, "", fmt.Errorf("unknown input format %s", name)
+	}
+	s, err := f.Open(path, o)
+	if err != nil {
+		return nil, "", err
+	}
+	return s, name, nil
+}
+
+// Probe is an input being detected. What is read of it is kept, so each format sniffing it doesn't read it again.
+type Probe struct {
+	Path string
+	FS   fs.FS  // the ZIP or directory, nil for any other file
+	Head []byte // the first 512 bytes of a file
+
+	closer     io.Closer
+	csvHeader  []string
+	jsonKeys   map[string]bool
+	readHeader bool
+	readKeys   bool
+}
+
+func newProbe(path string) (*Probe, error) {
+	fsys, closer, err := csv.OpenArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Probe{Path: path, FS: fsys, closer: closer}
+	if fsys != nil {
+		return p, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %w", err)
+	}
+	defer file.Close()
+	p.Head, _ = bufio.NewReader(file).Peek(512)
+	return p, nil
+}
+
+func (p *Probe) close() {
+	if p.closer != nil {
+		p.closer.Close()
+	}
+}
+
+// CSVHeader returns the first row of a CSV file, nil if the input isn't a CSV file.
+func (p *Probe) CSVHeader() []string {
+	if p.FS != nil || p.readHeader {
+		return p.csvHeader
+	}
+	p.readHeader = true
+	file, err := os.Open(p.Path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	p.csvHeader, _ = csv.ReadHeader(file)
+	return p.csvHeader
+}
+
+// JSONKeys returns the keys of the first object in a file holding a JSON array of objects, nil for any other input.
+func (p *Probe) JSONKeys() map[string]bool {
+	if p.FS != nil || p.readKeys {
+		return p.jsonKeys
+	}
+	p.readKeys = true
+	if trimmed := strings.TrimSpace(string(p.Head)); !strings.HasPrefix(trimmed, "[") {
+		return nil
+	}
+	file, err := os.Open(p.Path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	dec := json.NewDecoder(file)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil
+	}
+	var first map[string]json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return nil
+	}
+	p.jsonKeys = map[string]bool{}
+	for key := range first {
+		p.jsonKeys[key] = true
+	}
+	return p.jsonKeys
+}
+
+// Glob reports whether the ZIP or directory contains files matching pattern.
+func (p *Probe) Glob(pattern string) bool {
+	if p.FS == nil {
+		return false
+	}
+	names, _ := fs.Glob(p.FS, pattern)
+	return len(names) > 0
+}
@@ -0,0 +1,166 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+	"github.com/fergalsomers/pocket-obsidian/page"
+)
+
+// Item is an article read from an input, whatever its format.
+type Item struct {
+	URL        string
+	Title      string // the URL if the input has no title, it is replaced by the article title when the page is clipped
+	Added      time.Time
+	Tags       []string
+	Read       bool
+	Folder     string           // sub-directory of the output directory for the note
+	Starred    bool             // starred, favourited or marked in the service
+	HTML       string           // the article as stored by the service, used instead of retrieving it
+	Highlights []page.Highlight // passages highlighted in the service
+}
+
+// Source yields the items of an input in order. Next returns io.EOF after the last item.
+// A *RecordError is returned for an entry that can't be read, Next can be called again for the rest.
+type Source interface {
+	Next() (*Item, error)
+}
+
+// RecordError is an entry of an input that couldn't be read, as a Pocket record (title,url,time_added,tags,status).
+type RecordError struct {
+	Record []string
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("bad record %v: %v", e.Record, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// ReadAll reads the remaining items of s, along with the entries that couldn't be read.
+func ReadAll(s Source) ([]*Item, []*RecordError, error) {
+	items := []*Item{}
+	bad := []*RecordError{}
+	for {
+		item, err := s.Next()
+		var recordErr *RecordError
+		switch {
+		case err == io.EOF:
+			return items, bad, nil
+		case errors.As(err, &recordErr):
+			bad = append(bad, recordErr)
+		case err != nil:
+			return nil, nil, err
+		default:
+			items = append(items, item)
+		}
+	}
+}
+
+type itemSource struct {
+	items []*Item
+}
+
+// Items is a Source of the given items.
+func Items(items ...*Item) Source {
+	return &itemSource{items: items}
+}
+
+func (s *itemSource) Next() (*Item, error) {
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+// URL is the item for a bare URL, added now so it is clipped just like a freshly saved Pocket entry.
+func URL(url string, now time.Time) *Item {
+	return &Item{URL: url, Title: url, Added: now}
+}
+
+// Record returns the item as a Pocket record (title,url,time_added,tags,status), as written to the failed CSV.
+func (i *Item) Record() []string {
+	status := "unread"
+	if i.Read {
+		status = "archive"
+	}
+	return []string{i.Title, i.URL, strconv.FormatInt(i.Added.Unix(), 10), strings.Join(i.Tags, "|"), status}
+}
+
+// Page converts the item to a page, with the mandatory tags before its own.
+func (i *Item) Page(markRead bool, mandatoryTags []string) *page.Page {
+	return &page.Page{
+		Title:      i.Title,
+		Url:        i.URL,
+		TimeAdded:  i.Added.Unix(),
+		Tags:       page.MergeTags(mandatoryTags, i.Tags),
+		Read:       i.Read || markRead,
+		Highlights: i.Highlights,
+		Folder:     i.Folder,
+		Starred:    i.Starred,
+		HTML:       i.HTML,
+	}
+}
+
+// recordSource yields the items of Pocket records, with their highlights.
+type recordSource struct {
+	records    [][]string
+	highlights map[string][]page.Highlight // keyed by canonical.Key of the URL
+}
+
+// Records is a Source of Pocket records (title,url,time_added,tags,status).
+// highlights, keyed by canonical.Key of the URL as read by csv.ReadAnnotations, may be nil.
+func Records(records [][]string, highlights map[string][]page.Highlight) Source {
+	return &recordSource{records: records, highlights: highlights}
+}
+
+func (s *recordSource) Next() (*Item, error) {
+	if len(s.records) == 0 {
+		return nil, io.EOF
+	}
+	record := s.records[0]
+	s.records = s.records[1:]
+	item, err := recordItem(record)
+	if err != nil {
+		return nil, &RecordError{Record: record, Err: err}
+	}
+	item.Highlights = s.highlights[canonical.Key(item.URL)]
+	return item, nil
+}
+
+func recordItem(record []string) (*Item, error) {
+	if len(record) < 5 {
+		return nil, fmt.Errorf("expected 5 columns (title,url,time_added,tags,status), found %d", len(record))
+	}
+	added, err := strconv.ParseInt(record[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing time_added [%s]: %w", record[2], err)
+	}
+	tags := []string{}
+	for _, t := range strings.Split(record[3], "|") {
+		if t != "" {
+			tags = append(tags, t)
+		}
+	}
+	title := record[0]
+	if title == "" {
+		title = record[1]
+	}
+	return &Item{
+		URL:   record[1],
+		Title: title,
+		Added: time.Unix(added, 0),
+		Tags:  tags,
+		Read:  record[4] != "unread",
+	}, nil
+}
@@ -0,0 +1,235 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSource(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "source suite")
+}
+
+// csvdata is the test data of the csv package, which reads the CSV files of the built in formats.
+var csvdata = filepath.Join("..", "csv", "testdata")
+
+var _ = Describe("SourceTest", func() {
+
+	options := Options{FolderAsTag: true, Now: time.Unix(1760000000, 0)}
+
+	It("Should detect the built in formats", func() {
+		for file, expected := range map[string]string{
+			filepath.Join(csvdata, "test.csv"):                            "pocket",
+			filepath.Join(csvdata, "export"):                              "pocket",
+			filepath.Join(csvdata, "instapaper.csv"):                      "instapaper",
+			filepath.Join("testdata", "bookmarks.html"):                   "bookmarks",
+			filepath.Join("testdata", "wallabag.json"):                    "wallabag",
+			filepath.Join("testdata", "readeck.json"):                     "readeck",
+			filepath.Join("testdata", "omnivore"):                         "omnivore",
+			filepath.Join("testdata", "omnivore", "metadata_0_to_1.json"): "omnivore",
+		} {
+			format, err := Detect(file)
+			Expect(err).To(BeNil(), file)
+			Expect(format).To(Equal(expected), file)
+		}
+	})
+
+	It("Should reject an unknown format", func() {
+		_, err := Detect(filepath.Join("testdata", "omnivore", "content", "aperture-in-photography-18b0.html"))
+		Expect(err).NotTo(BeNil())
+		_, _, err = Open(filepath.Join(csvdata, "test.csv"), "netscape", options)
+		Expect(err).NotTo(BeNil())
+
+		links := filepath.Join(GinkgoT().TempDir(), "links.json")
+		Expect(os.WriteFile(links, []byte(`[{"href": "https://example.com/", "is_archived": false}]`), 0644)).To(Succeed())
+		_, err = Detect(links)
+		Expect(err).NotTo(BeNil(), "any JSON with links isn't a Readeck list")
+	})
+
+	It("Should read a Pocket export with its highlights", func() {
+		s, format, err := Open(filepath.Join(csvdata, "export"), Auto, options)
+		Expect(err).To(BeNil())
+		Expect(format).To(Equal("pocket"))
+		Expect(s.(*PocketSource).Parts).To(HaveLen(2))
+		Expect(s.(*PocketSource).Annotated).To(Equal(1))
+
+		items, bad, err := ReadAll(s)
+		Expect(err).To(BeNil())
+		Expect(bad).To(BeEmpty())
+		Expect(items).To(HaveLen(3))
+		Expect(items[0].Title).To(Equal("Introduction - Updatecli"))
+		Expect(items[0].Added).To(Equal(time.Unix(1746041473, 0)))
+		highlighted := 0
+		for _, item := range items {
+			highlighted += len(item.Highlights)
+		}
+		Expect(highlighted).To(BeNumerically(">", 0))
+	})
+
+	It("Should read stored articles", func() {
+		s, _, err := Open(filepath.Join("testdata", "wallabag.json"), Auto, options)
+		Expect(err).To(BeNil())
+		items, _, err := ReadAll(s)
+		Expect(err).To(BeNil())
+		Expect(items[0].Starred).To(BeTrue())
+		Expect(items[0].Read).To(BeTrue())
+		Expect(items[0].Tags).To(Equal([]string{"ai", "ceo"}))
+		Expect(items[0].HTML).NotTo(BeEmpty())
+	})
+
+	It("Should report records that can't be read and carry on", func() {
+		s := Records([][]string{
+			{"A", "https://example.com/a", "yesterday", "", "unread"},
+			{"", "https://example.com/b", "1747900713", "go|", "archive"},
+		}, nil)
+		_, err := s.Next()
+		var recordErr *RecordError
+		Expect(errors.As(err, &recordErr)).To(BeTrue())
+		Expect(recordErr.Record[0]).To(Equal("A"))
+
+		item, err := s.Next()
+		Expect(err).To(BeNil())
+		Expect(item).To(Equal(&Item{URL: "https://example.com/b", Title: "https://example.com/b", Added: time.Unix(1747900713, 0), Tags: []string{"go"}, Read: true}))
+		_, err = s.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("Should convert an item to a page and a record", func() {
+		item := &Item{
+			URL:        "https://example.com/a",
+			Title:      "A",
+			Added:      time.Unix(1747900713, 0),
+			Tags:       []string{"go", "Clippings"},
+			Folder:     "Tech",
+			Highlights: []page.Highlight{{Quote: "a passage"}},
+		}
+		p := item.Page(true, []string{"clippings", "pocket"})
+		Expect(p.Tags).To(Equal([]string{"clippings", "pocket", "go"}))
+		Expect(p.Read).To(BeTrue())
+		Expect(p.TimeAdded).To(Equal(int64(1747900713)))
+		Expect(p.Folder).To(Equal("Tech"))
+		Expect(p.Highlights).To(HaveLen(1))
+		Expect(item.Record()).To(Equal([]string{"A", "https://example.com/a", "1747900713", "go|Clippings", "unread"}))
+	})
+
+	It("Should open registered formats", func() {
+		Register(Format{
+			Name: "test-list",
+			Open: func(path string, o Options) (Source, error) {
+				return Items(URL("https://example.com/"+filepath.Base(path), o.Now)), nil
+			},
+		})
+		Expect(Formats()).To(ContainElement("test-list"))
+		Expect(func() { Register(Format{Name: "pocket"}) }).To(Panic())
+
+		s, format, err := Open("list.txt", "test-list", options)
+		Expect(err).To(BeNil())
+		Expect(format).To(Equal("test-list"))
+		items, _, err := ReadAll(s)
+		Expect(err).To(BeNil())
+		Expect(items).To(Equal([]*Item{{URL: "https://example.com/list.txt", Title: "https://example.com/list.txt", Added: options.Now}}))
+	})
+
+	It("Should keep the highlights of Pocket records", func() {
+		s := Records([][]string{{"A", "http://www.example.com/a/", "1747900713", "", "unread"}},
+			map[string][]page.Highlight{"example.com/a": {{Quote: "a passage"}}})
+		item, err := s.Next()
+		Expect(err).To(BeNil())
+		Expect(item.Highlights).To(Equal([]page.Highlight{{Quote: "a passage"}}))
+	})
+
+	Context("InstapaperTest", func() {
+
+		It("Should read an Instapaper export with folders as tags", func() {
+			s, err := ReadInstapaper(filepath.Join(csvdata, "instapaper.csv"), true)
+			Expect(err).To(BeNil())
+			items, bad, err := ReadAll(s)
+			Expect(err).To(BeNil())
+			Expect(bad).To(BeEmpty())
+			Expect(items).To(HaveLen(3))
+			Expect(items[0].Record()).To(Equal([]string{"AI Can (Mostly) Outperform Human CEOs", "https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos", "1747900713", "", "unread"}))
+			Expect(items[1].Record()).To(Equal([]string{"Introduction - Updatecli", "https://www.updatecli.io/docs/prologue/introduction/", "1746041473", "", "archive"}))
+			Expect(items[2].Record()).To(Equal([]string{"https://digital-photography-school.com/aperture/", "https://digital-photography-school.com/aperture/", "1695216244", "Photography", "unread"}))
+			Expect(items[0].Highlights).To(Equal([]page.Highlight{{Quote: "the AI outperformed human participants on most metrics", CreatedAt: 1747900713}}))
+		})
+
+		It("Should read an Instapaper export with folders", func() {
+			s, err := ReadInstapaper(filepath.Join(csvdata, "instapaper.csv"), false)
+			Expect(err).To(BeNil())
+			items, _, err := ReadAll(s)
+			Expect(err).To(BeNil())
+			Expect(items[2].Tags).To(BeEmpty())
+			Expect(items[2].Folder).To(Equal("Photography"))
+		})
+	})
+
+	Context("BookmarksTest", func() {
+
+		It("Should read bookmarks with folders as tags", func() {
+			items, err := ReadBookmarks(filepath.Join("testdata", "bookmarks.html"), true, options.Now)
+			Expect(err).To(BeNil())
+			Expect(items).To(Equal([]*Item{
+				{URL: "https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos", Title: "AI Can (Mostly) Outperform Human CEOs", Added: time.Unix(1747900713, 0), Tags: []string{"ai", "ceo"}},
+				{URL: "https://www.updatecli.io/docs/prologue/introduction/", Title: "Introduction - Updatecli", Added: time.Unix(1746041473, 0), Tags: []string{"Tech/Kubernetes - GitOps"}},
+				{URL: "https://digital-photography-school.com/aperture/", Title: "Aperture in Photography & Examples", Added: options.Now, Tags: []string{}},
+			}))
+		})
+
+		It("Should read bookmarks with folders", func() {
+			items, err := ReadBookmarks(filepath.Join("testdata", "bookmarks.html"), false, options.Now)
+			Expect(err).To(BeNil())
+			Expect(items[1].Tags).To(BeEmpty())
+			Expect(items[1].Folder).To(Equal("Tech/Kubernetes - GitOps"))
+		})
+	})
+
+	Context("ReadLaterTest", func() {
+
+		It("Should read a wallabag export", func() {
+			items, err := ReadWallabag(filepath.Join("testdata", "wallabag.json"), options.Now)
+			Expect(err).To(BeNil())
+			Expect(items).To(HaveLen(2))
+			Expect(items[0].Record()).To(Equal([]string{"AI Can (Mostly) Outperform Human CEOs", "https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos", "1747903113", "ai|ceo", "archive"}))
+			Expect(items[1].Record()).To(Equal([]string{"Introduction - Updatecli", "https://www.updatecli.io/docs/prologue/introduction/", "1746041473", "", "unread"}))
+			Expect(items[0].Starred).To(BeTrue())
+			Expect(items[0].HTML).To(ContainSubstring("Stored by wallabag."))
+			Expect(items[0].Highlights).To(HaveLen(1))
+			Expect(items[1].HTML).To(BeEmpty())
+		})
+
+		It("Should read a Readeck bookmark list", func() {
+			items, err := ReadReadeck(filepath.Join("testdata", "readeck.json"), options.Now)
+			Expect(err).To(BeNil())
+			Expect(items).To(HaveLen(2))
+			Expect(items[0].Record()).To(Equal([]string{"Introduction - Updatecli", "https://www.updatecli.io/docs/prologue/introduction/", "1746041473", "gitops", "unread"}))
+			Expect(items[0].Starred).To(BeTrue())
+			Expect(items[0].HTML).To(ContainSubstring("Stored by Readeck."))
+			Expect(items[1].Read).To(BeTrue())
+			Expect(items[1].HTML).To(BeEmpty(), "no article was saved")
+		})
+
+		It("Should read an Omnivore export with its content", func() {
+			items, err := ReadOmnivore(filepath.Join("testdata", "omnivore"), options.Now)
+			Expect(err).To(BeNil())
+			Expect(items).To(HaveLen(1))
+			Expect(items[0].Record()).To(Equal([]string{"Aperture in Photography", "https://digital-photography-school.com/aperture/", "1695216244", "photography", "archive"}))
+			Expect(items[0].HTML).To(ContainSubstring("The aperture is the opening in the lens."))
+			Expect(items[0].Highlights).To(HaveLen(1))
+			Expect(items[0].Highlights[0].CreatedAt).To(Equal(int64(1695302644)))
+
+			// the metadata file alone still finds the content alongside it
+			items, err = ReadOmnivore(filepath.Join("testdata", "omnivore", "metadata_0_to_1.json"), options.Now)
+			Expect(err).To(BeNil())
+			Expect(items[0].HTML).NotTo(BeEmpty())
+		})
+	})
+})
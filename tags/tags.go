@@ -0,0 +1,147 @@
+package tags
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Normaliser turns Pocket tags into valid Obsidian tags.
+type Normaliser struct {
+	Lowercase bool              // lower case every tag
+	Kebab     bool              // kebab-case every tag: lower case with words separated by -
+	Mapping   map[string]string // rename tags, matched ignoring case. Map to "" to drop a tag, use / to nest (ai: topic/ai)
+}
+
+// Normalise sanitises, maps and de-duplicates tags, keeping the order of first appearance.
+// Obsidian tags are case insensitive, so tags differing only in case are duplicates.
+func (n *Normaliser) Normalise(tags []string) []string {
+	normalised := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = n.normalise(t)
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		normalised = append(normalised, t)
+	}
+	return normalised
+}
+
+func (n *Normaliser) normalise(t string) string {
+	t = Sanitise(t)
+	if mapped, ok := n.lookup(t); ok {
+		t = Sanitise(mapped)
+	}
+	if n.Kebab {
+		t = kebab(t)
+	} else if n.Lowercase {
+		t = strings.ToLower(t)
+	}
+	return t
+}
+
+// lookup returns the mapping of t, matched ignoring case on the whole tag or its leading levels (ai maps ai/llm too).
+// The longest match wins, and of keys matching the same tag (AI and ai) the first in sorted order.
+func (n *Normaliser) lookup(t string) (string, bool) {
+	if t == "" {
+		return "", false
+	}
+	lower := strings.ToLower(t)
+	key, mapped, found := "", "", false
+	for from, to := range n.Mapping {
+		f := strings.ToLower(Sanitise(from))
+		if f == "" || (lower != f && !strings.HasPrefix(lower, f+"/")) {
+			continue
+		}
+		if best := strings.ToLower(Sanitise(key)); !found || len(f) > len(best) || (len(f) == len(best) && from < key) {
+			key, found = from, true
+			mapped = to
+			if nested := strings.Split(t, "/")[strings.Count(f, "/")+1:]; to != "" && len(nested) > 0 {
+				mapped += "/" + strings.Join(nested, "/")
+			}
+		}
+	}
+	return mapped, found
+}
+
+var dashes = regexp.MustCompile(`-{2,}`)
+
+// Sanitise converts t to Obsidian tag syntax: letters, numbers, _, - and / for nesting.
+// Spaces become -, other characters are dropped and a purely numeric tag is prefixed with _.
+// Returns "" if nothing is left.
+func Sanitise(t string) string {
+	t = strings.TrimLeft(strings.TrimSpace(t), "#")
+	var b strings.Builder
+	space := false
+	for _, r := range t {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '/':
+			if space && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			space = false
+			b.WriteRune(r)
+		}
+	}
+
+	// tidy up the nesting: no empty, leading or trailing levels
+	levels := []string{}
+	for _, level := range strings.Split(dashes.ReplaceAllString(b.String(), "-"), "/") {
+		if level != "" {
+			levels = append(levels, level)
+		}
+	}
+	s := strings.Join(levels, "/")
+
+	if s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) && r != '/' }) < 0 {
+		s = "_" + s // tags must contain at least one non-numeric character
+	}
+	return s
+}
+
+// kebab converts a sanitised tag to kebab-case, splitting camelCase and _ separated words.
+func kebab(t string) string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, r := range t {
+		switch {
+		case r == '_' || r == '-':
+			if prev != '-' && prev != '/' && prev != 0 {
+				b.WriteRune('-')
+				prev = '-'
+			}
+			continue
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			b.WriteRune('-')
+		}
+		b.WriteRune(unicode.ToLower(r))
+		prev = r
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// ReadMapping reads a YAML file of tag renames, for example
+//
+//	ai: topic/ai
+//	ml: topic/ai/machine-learning
+//	toread: ""
+func ReadMapping(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tag mapping file: %w", err)
+	}
+	mapping := map[string]string{}
+	if err := yaml.Unmarshal(b, &mapping); err != nil {
+		return nil, fmt.Errorf("failed to read tag mapping file %s: %w", path, err)
+	}
+	return mapping, nil
+}
@@ -0,0 +1,64 @@
+package tags
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTags(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "tags suite")
+}
+
+var _ = Describe("TagsTest", func() {
+
+	It("Should sanitise tags to Obsidian syntax", func() {
+		Expect(Sanitise("photography")).To(Equal("photography"))
+		Expect(Sanitise("#gitops")).To(Equal("gitops"))
+		Expect(Sanitise("  machine learning ")).To(Equal("machine-learning"))
+		Expect(Sanitise("c++ & go!")).To(Equal("c-go"))
+		Expect(Sanitise("topic//ai/")).To(Equal("topic/ai"))
+		Expect(Sanitise("Tech/Kubernetes - GitOps")).To(Equal("Tech/Kubernetes-GitOps"))
+		Expect(Sanitise("2024")).To(Equal("_2024"))
+		Expect(Sanitise("café")).To(Equal("café"))
+		Expect(Sanitise("")).To(Equal(""))
+		Expect(Sanitise("!!!")).To(Equal(""))
+	})
+
+	It("Should drop empty and duplicate tags keeping the mandatory tags first", func() {
+		n := Normaliser{}
+		Expect(n.Normalise([]string{"clippings", "pocket", "", "AI", "Pocket", "ai"})).To(Equal([]string{"clippings", "pocket", "AI"}))
+	})
+
+	It("Should lower case tags", func() {
+		n := Normaliser{Lowercase: true}
+		Expect(n.Normalise([]string{"AI", "Machine Learning"})).To(Equal([]string{"ai", "machine-learning"}))
+	})
+
+	It("Should kebab case tags", func() {
+		n := Normaliser{Kebab: true}
+		Expect(n.Normalise([]string{"MachineLearning", "big_data", "Topic/DevOps Tools"})).To(Equal([]string{"machine-learning", "big-data", "topic/dev-ops-tools"}))
+	})
+
+	It("Should map tags from a mapping file", func() {
+		mapping, err := ReadMapping(filepath.Join("testdata", "mapping.yaml"))
+		Expect(err).To(BeNil())
+		n := Normaliser{Mapping: mapping}
+		Expect(n.Normalise([]string{"clippings", "AI", "machine learning", "toread", "topic/ai"})).To(Equal([]string{"clippings", "topic/ai", "topic/ai/machine-learning"}))
+	})
+
+	It("Should map nested tags by their longest mapped level", func() {
+		n := Normaliser{Mapping: map[string]string{"tech": "topic/tech", "tech/go": "lang/go", "Tech/Go": "golang", "old": ""}}
+		for range 10 {
+			Expect(n.Normalise([]string{"Tech/k8s", "tech/go/generics", "old/stuff", "technology"})).To(Equal([]string{"topic/tech/k8s", "golang/generics", "technology"}))
+		}
+	})
+
+	It("Should fail on a missing mapping file", func() {
+		_, err := ReadMapping(filepath.Join("testdata", "missing.yaml"))
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,90 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"gopkg.in/yaml.v3"
+)
+
+// GeneratedBy is the generated_by property of the notes pocket-obsidian generates (maps of content and the like),
+// they are rewritten on every run. Notes without it are the user's and are never overwritten.
+const GeneratedBy = "pocket-obsidian"
+
+// GeneratedNotice starts the body of a generated note, warning that edits are lost.
+const GeneratedNotice = "_Generated by " + GeneratedBy + ", changes are overwritten._"
+
+// GeneratedKey is the frontmatter property holding GeneratedBy.
+const GeneratedKey = "generated_by"
+
+// KindKey is the frontmatter property of a generated note naming the generator that wrote it,
+// such as moc or site, so each only removes its own notes.
+const KindKey = "generated_kind"
+
+// Generated reports whether the note at path was generated by pocket-obsidian, so may be rewritten.
+// A missing note can be generated.
+func Generated(path string) (bool, error) {
+	generated, _, err := generatedKind(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	return generated, err
+}
+
+// generatedKind reports whether the note at path was generated by pocket-obsidian, and the kind it was marked with.
+func generatedKind(path string) (bool, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false, "", err
+	}
+	parts := bytes.SplitN(b, page.ByteDelimiter, 3)
+	if len(parts) != 3 || len(bytes.TrimSpace(parts[0])) != 0 {
+		return false, "", nil
+	}
+	var frontmatter map[string]any
+	if err := yaml.Unmarshal(parts[1], &frontmatter); err != nil {
+		return false, "", nil
+	}
+	kind, _ := frontmatter[KindKey].(string)
+	return frontmatter[GeneratedKey] == GeneratedBy, kind, nil
+}
+
+// RemoveStale removes the notes of the kind generated by pocket-obsidian below dir which aren't in keep, a set of paths.
+// Hidden directories, such as .obsidian, are skipped. Returns the number removed.
+func RemoveStale(dir string, kind string, keep map[string]bool) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".md" || keep[path] {
+			return nil
+		}
+		if generated, k, err := generatedKind(path); err != nil || !generated || k != kind {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("error removing stale notes from %s: %w", dir, err)
+	}
+	return removed, nil
+}
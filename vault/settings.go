@@ -0,0 +1,185 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	nurl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigDir is the folder of a vault holding Obsidian's settings, its presence makes a directory a vault.
+const ConfigDir = ".obsidian"
+
+// Values of newLinkFormat in app.json.
+const (
+	LinkShortest = "shortest"
+	LinkRelative = "relative"
+	LinkAbsolute = "absolute"
+)
+
+// Links writes links between the notes of the vault at Root as Obsidian is set to.
+type Links struct {
+	Root     string
+	Format   string // LinkShortest, LinkRelative or LinkAbsolute, shortest links are written as absolute ones
+	Markdown bool   // [alias](path.md) rather than [[path|alias]]
+}
+
+// Target returns the target of a link from the note at from to the file at to.
+// Markdown notes are linked without their .md extension in wikilinks.
+func (l Links) Target(from string, to string) string {
+	base := l.Root
+	if l.Format == LinkRelative && from != "" {
+		base = filepath.Dir(from)
+	}
+	target := to
+	if rel, err := filepath.Rel(base, to); err == nil {
+		target = rel
+	}
+	target = filepath.ToSlash(target)
+	if l.Markdown {
+		return (&nurl.URL{Path: target}).EscapedPath()
+	}
+	return strings.TrimSuffix(target, ".md")
+}
+
+// Link returns a link from the note at from to the file at to, shown as alias.
+func (l Links) Link(from string, to string, alias string) string {
+	target := l.Target(from, to)
+	if l.Markdown {
+		if alias == "" {
+			alias = strings.TrimSuffix(path.Base(filepath.ToSlash(to)), ".md")
+		}
+		return "[" + strings.NewReplacer("[", "(", "]", ")").Replace(alias) + "](" + target + ")"
+	}
+	alias = strings.NewReplacer("|", "-", "[", "(", "]", ")").Replace(alias)
+	if alias == "" || alias == target {
+		return "[[" + target + "]]"
+	}
+	return "[[" + target + "|" + alias + "]]"
+}
+
+// Linked reports whether text, in the note at from, already links to the file at to, as a wikilink or a Markdown link,
+// relative to the vault or as l writes links.
+func (l Links) Linked(text string, from string, to string) bool {
+	for _, format := range []string{l.Format, LinkAbsolute} {
+		for _, markdown := range []bool{false, true} {
+			target := Links{Root: l.Root, Format: format, Markdown: markdown}.Target(from, to)
+			if markdown && strings.Contains(text, "]("+target+")") {
+				return true
+			}
+			if !markdown && (strings.Contains(text, "[["+target+"]]") || strings.Contains(text, "[["+target+"|")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DailyNotes are the settings of the daily notes core plugin, daily-notes.json.
+type DailyNotes struct {
+	Folder   string `json:"folder"`
+	Format   string `json:"format"`
+	Template string `json:"template"` // note of the vault, without .md
+}
+
+// NewFileFolder is the newFileLocation in app.json placing new notes in newFileFolderPath.
+const NewFileFolder = "folder"
+
+// Settings are the settings of an Obsidian vault affecting the notes written to it.
+type Settings struct {
+	Root             string // the directory holding ConfigDir
+	AttachmentFolder string // attachmentFolderPath in app.json, "" if it isn't set
+	NewNotesFolder   string // newFileFolderPath in app.json if newFileLocation is NewFileFolder, otherwise "" for the root
+	Links            Links
+	TemplatesFolder  string // folder in templates.json
+	TimeFormat       string // timeFormat in templates.json
+	Daily            DailyNotes
+}
+
+// Find returns the vault dir is in, the closest directory at or above dir holding ConfigDir.
+// The vault is returned relative to the working directory if dir is.
+func Find(dir string) (string, bool) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(abs, ConfigDir)); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", false
+		}
+		abs = parent
+	}
+	if filepath.IsAbs(dir) {
+		return abs, true
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return abs, true
+	}
+	if rel, err := filepath.Rel(wd, abs); err == nil {
+		return rel, true
+	}
+	return abs, true
+}
+
+// ReadSettings reads the settings of the vault at root, missing settings files have the defaults.
+func ReadSettings(root string) (*Settings, error) {
+	var app struct {
+		AttachmentFolderPath string `json:"attachmentFolderPath"`
+		NewFileLocation      string `json:"newFileLocation"`
+		NewFileFolderPath    string `json:"newFileFolderPath"`
+		NewLinkFormat        string `json:"newLinkFormat"`
+		UseMarkdownLinks     bool   `json:"useMarkdownLinks"`
+	}
+	var templates struct {
+		Folder     string `json:"folder"`
+		TimeFormat string `json:"timeFormat"`
+	}
+	s := &Settings{Root: root}
+	for name, v := range map[string]any{"app.json": &app, "templates.json": &templates, "daily-notes.json": &s.Daily} {
+		b, err := os.ReadFile(filepath.Join(root, ConfigDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = json.Unmarshal(b, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading Obsidian settings %s: %w", name, err)
+		}
+	}
+	s.AttachmentFolder = app.AttachmentFolderPath
+	if app.NewFileLocation == NewFileFolder {
+		s.NewNotesFolder = strings.Trim(app.NewFileFolderPath, "/")
+	}
+	s.Links = Links{Root: root, Format: app.NewLinkFormat, Markdown: app.UseMarkdownLinks}
+	s.TemplatesFolder = templates.Folder
+	s.TimeFormat = templates.TimeFormat
+	return s, nil
+}
+
+// NewNotes returns the folder Obsidian creates new notes in: the root of the vault, or the folder set.
+// Notes are never created next to the current note, as there is none.
+func (s *Settings) NewNotes() string {
+	return filepath.Join(s.Root, filepath.FromSlash(s.NewNotesFolder))
+}
+
+// Attachments returns the folder for the attachments of the note at note, as attachmentFolderPath sets:
+// / for the root of the vault, ./ for the note's folder, ./sub for a sub-folder of it, or a folder of the vault.
+func (s *Settings) Attachments(note string) string {
+	folder := s.AttachmentFolder
+	switch {
+	case folder == "" || folder == "/":
+		return s.Root
+	case folder == "." || strings.HasPrefix(folder, "./"):
+		return filepath.Join(filepath.Dir(note), filepath.FromSlash(folder))
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(folder))
+}
@@ -0,0 +1,53 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TypesPath is the file of an Obsidian vault declaring the types of its properties.
+const TypesPath = ".obsidian/types.json"
+
+// PropertyTypes are the Obsidian types of the clipping properties, so Bases and Dataview can sort and compare them.
+var PropertyTypes = map[string]string{
+	"source":       "text",
+	"author":       "multitext",
+	"created":      "datetime",
+	"read":         "checkbox",
+	"status":       "text",
+	"domain":       "text",
+	"site":         "text",
+	"word_count":   "number",
+	"reading_time": "number",
+	"highlights":   "number",
+	"starred":      "checkbox",
+}
+
+// MergeTypes returns the content of types.json with the PropertyTypes which aren't declared yet added, keeping the
+// types already declared, including those the user set for these properties. Content can be empty, for a vault
+// without one. Reports whether anything changed.
+func MergeTypes(content []byte) ([]byte, bool, error) {
+	file := map[string]any{}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &file); err != nil {
+			return nil, false, fmt.Errorf("error reading %s: %w", TypesPath, err)
+		}
+	}
+	types, ok := file["types"].(map[string]any)
+	if !ok {
+		types = map[string]any{}
+		file["types"] = types
+	}
+	changed := len(content) == 0
+	for property, t := range PropertyTypes {
+		if _, declared := types[property]; !declared {
+			types[property] = t
+			changed = true
+		}
+	}
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, false, fmt.Errorf("error writing %s: %w", TypesPath, err)
+	}
+	return b, changed, nil
+}
@@ -0,0 +1,137 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"gopkg.in/yaml.v3"
+)
+
+// Note is a clipping already present in the output directory.
+type Note struct {
+	Path     string
+	Clipping *page.Clipping
+}
+
+// Scan reads every clipping note (a markdown file with a source in its frontmatter) below dir.
+// Other markdown files and hidden directories such as .obsidian are ignored. A missing dir has no notes.
+func Scan(dir string) ([]Note, error) {
+	notes := []Note{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".md" {
+			return nil
+		}
+		c, err := ReadNote(path)
+		if err != nil || c.Metadata.Source == "" {
+			return nil // not a clipping
+		}
+		notes = append(notes, Note{Path: path, Clipping: c})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", dir, err)
+	}
+	return notes, nil
+}
+
+// ReadNote reads the clipping at path.
+func ReadNote(path string) (*page.Clipping, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return page.ReadClipping(bytes.NewReader(b))
+}
+
+// EditFrontmatter applies edit to the YAML mapping of the note's frontmatter and rewrites the note if edit reports a change.
+// Working on the YAML nodes keeps any properties, ordering and comments added to the note in Obsidian.
+func EditFrontmatter(path string, edit func(m *yaml.Node) bool) (bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	parts := bytes.SplitN(b, page.ByteDelimiter, 3)
+	if len(parts) != 3 {
+		return false, fmt.Errorf("note %s has no frontmatter", path)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(parts[1], &doc); err != nil {
+		return false, fmt.Errorf("error unmarshalling frontmatter of %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false, fmt.Errorf("note %s frontmatter is not a mapping", path)
+	}
+	if !edit(doc.Content[0]) {
+		return false, nil
+	}
+	frontmatter, err := yaml.Marshal(&doc)
+	if err != nil {
+		return false, err
+	}
+	var out bytes.Buffer
+	out.Write(parts[0])
+	out.Write(page.ByteDelimiter)
+	out.Write(frontmatter)
+	out.Write(page.ByteDelimiter)
+	out.Write(parts[2])
+	return true, os.WriteFile(path, out.Bytes(), 0644)
+}
+
+// MergeTags adds any of tags missing from the note at path, reporting whether the note changed.
+func MergeTags(path string, tags []string) (bool, error) {
+	return EditFrontmatter(path, func(m *yaml.Node) bool {
+		seq := mappingValue(m, "tags")
+		if seq == nil || seq.Kind != yaml.SequenceNode {
+			seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			setMappingValue(m, "tags", seq)
+		}
+		existing := make([]string, 0, len(seq.Content))
+		for _, n := range seq.Content {
+			existing = append(existing, n.Value)
+		}
+		changed := false
+		for _, t := range page.MergeTags(existing, tags)[len(existing):] {
+			seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t})
+			changed = true
+		}
+		return changed
+	})
+}
+
+// mappingValue returns the value node for key in the mapping m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets (or appends) key to value in the mapping m.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
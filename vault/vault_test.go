@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestVault(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "vault suite")
+}
+
+const testNote = `---
+title: AI Can (Mostly) Outperform Human CEOs
+source: https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos
+created: "2025-05-22"
+tags:
+    - clippings
+    - ai
+read: false
+rating: 5 # added in Obsidian
+---
+# AI CEOs
+
+---
+
+More content after a horizontal rule.
+`
+
+var _ = Describe("VaultTest", func() {
+
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "AI CEOs.md"), []byte(testNote), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "Not a clipping.md"), []byte("# Just a note\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, ".obsidian"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, ".obsidian", "hidden.md"), []byte(testNote), 0644)).To(Succeed())
+	})
+
+	It("Should scan clippings in the directory", func() {
+		notes, err := Scan(dir)
+		Expect(err).To(BeNil())
+		Expect(notes).To(HaveLen(1))
+		Expect(notes[0].Path).To(Equal(filepath.Join(dir, "AI CEOs.md")))
+		Expect(notes[0].Clipping.Metadata.Source).To(Equal("https://hbr.org/2024/09/ai-can-mostly-outperform-human-ceos"))
+		Expect(string(notes[0].Clipping.MarkdownContent)).To(ContainSubstring("More content after a horizontal rule."))
+	})
+
+	It("Should scan a missing directory as empty", func() {
+		notes, err := Scan(filepath.Join(dir, "missing"))
+		Expect(err).To(BeNil())
+		Expect(notes).To(BeEmpty())
+	})
+
+	It("Should merge tags keeping other properties", func() {
+		path := filepath.Join(dir, "AI CEOs.md")
+		changed, err := MergeTags(path, []string{"AI", "business"})
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeTrue())
+
+		b, err := os.ReadFile(path)
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(ContainSubstring("    - ai\n    - business\n"))
+		Expect(string(b)).To(ContainSubstring("rating: 5 # added in Obsidian"))
+		Expect(string(b)).To(ContainSubstring("More content after a horizontal rule."))
+
+		changed, err = MergeTags(path, []string{"business"})
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeFalse())
+	})
+
+	It("Should only treat notes with generated_by as generated", func() {
+		generated := filepath.Join(dir, "MOCs", "ai.md")
+		Expect(os.MkdirAll(filepath.Dir(generated), 0755)).To(Succeed())
+		Expect(os.WriteFile(generated, []byte("---\ngenerated_by: pocket-obsidian\n---\n# ai\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "MOCs", "mine.md"), []byte("---\ntags: [moc]\n---\n# Mine\n"), 0644)).To(Succeed())
+
+		for name, expected := range map[string]bool{
+			filepath.Join("MOCs", "ai.md"):      true,
+			filepath.Join("MOCs", "mine.md"):    false,
+			filepath.Join("MOCs", "missing.md"): true,
+			"AI CEOs.md":                        false,
+			"Not a clipping.md":                 false,
+		} {
+			ok, err := Generated(filepath.Join(dir, name))
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(expected), name)
+		}
+
+		// only the notes of the kind are removed, wherever the other generators write theirs
+		stale := filepath.Join(dir, "MOCs", "stale.md")
+		Expect(os.WriteFile(stale, []byte("---\ngenerated_by: pocket-obsidian\ngenerated_kind: moc\n---\n# stale\n"), 0644)).To(Succeed())
+		site := filepath.Join(dir, "MOCs", "hbr.org.md")
+		Expect(os.WriteFile(site, []byte("---\ngenerated_by: pocket-obsidian\ngenerated_kind: site\n---\n# HBR\n"), 0644)).To(Succeed())
+		hidden := filepath.Join(dir, "MOCs", ".trash", "old.md")
+		Expect(os.MkdirAll(filepath.Dir(hidden), 0755)).To(Succeed())
+		Expect(os.WriteFile(hidden, []byte("---\ngenerated_by: pocket-obsidian\ngenerated_kind: moc\n---\n# old\n"), 0644)).To(Succeed())
+
+		removed, err := RemoveStale(filepath.Join(dir, "MOCs"), "moc", map[string]bool{})
+		Expect(err).To(BeNil())
+		Expect(removed).To(Equal(1))
+		Expect(stale).NotTo(BeAnExistingFile())
+		Expect(generated).To(BeAnExistingFile(), "not marked with a kind")
+		Expect(site).To(BeAnExistingFile())
+		Expect(hidden).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "MOCs", "mine.md")).To(BeAnExistingFile())
+	})
+
+	It("Should link to notes from anywhere in the vault", func() {
+		l := Links{Root: dir}
+		from := filepath.Join(dir, "MOCs", "Go.md")
+		Expect(l.Link(from, filepath.Join(dir, "AI CEOs.md"), "AI CEOs")).To(Equal("[[AI CEOs]]"))
+		Expect(l.Link(from, filepath.Join(dir, "Tech", "Go.md"), "Go | The Language [draft]")).To(Equal("[[Tech/Go|Go - The Language (draft)]]"))
+		Expect(l.Link(from, filepath.Join(dir, "attachments", "Go.html"), "")).To(Equal("[[attachments/Go.html]]"))
+
+		l = Links{Root: dir, Format: LinkRelative, Markdown: true}
+		Expect(l.Link(from, filepath.Join(dir, "AI CEOs.md"), "")).To(Equal("[AI CEOs](../AI%20CEOs.md)"))
+		Expect(l.Link(from, filepath.Join(dir, "Tech", "Go.md"), "Go [draft]")).To(Equal("[Go (draft)](../Tech/Go.md)"))
+		Expect(l.Linked("see [[AI CEOs|this]]", from, filepath.Join(dir, "AI CEOs.md"))).To(BeTrue())
+		Expect(l.Linked("see [x](../AI%20CEOs.md)", from, filepath.Join(dir, "AI CEOs.md"))).To(BeTrue())
+		Expect(l.Linked("see [[AI]]", from, filepath.Join(dir, "AI CEOs.md"))).To(BeFalse())
+	})
+
+	It("Should find the vault and read its settings", func() {
+		_, ok := Find(GinkgoT().TempDir())
+		Expect(ok).To(BeFalse(), "no .obsidian")
+
+		root := GinkgoT().TempDir()
+		config := filepath.Join(root, ConfigDir)
+		Expect(os.MkdirAll(config, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(config, "app.json"), []byte(`{"attachmentFolderPath": "./assets", "newLinkFormat": "relative", "useMarkdownLinks": true, "newFileLocation": "folder", "newFileFolderPath": "Inbox/Web/"}`), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(config, "daily-notes.json"), []byte(`{"folder": "Journal", "format": "YYYY/YYYY-MM-DD", "template": "Templates/Day"}`), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(config, "templates.json"), []byte(`{"folder": "Templates", "timeFormat": "HH:mm:ss"}`), 0644)).To(Succeed())
+		clippings := filepath.Join(root, "Clippings")
+		Expect(os.MkdirAll(clippings, 0755)).To(Succeed())
+
+		found, ok := Find(clippings)
+		Expect(ok).To(BeTrue())
+		Expect(found).To(Equal(root))
+		s, err := ReadSettings(found)
+		Expect(err).To(BeNil())
+		Expect(s.Links).To(Equal(Links{Root: root, Format: LinkRelative, Markdown: true}))
+		Expect(s.Daily).To(Equal(DailyNotes{Folder: "Journal", Format: "YYYY/YYYY-MM-DD", Template: "Templates/Day"}))
+		Expect(s.TemplatesFolder).To(Equal("Templates"))
+		Expect(s.TimeFormat).To(Equal("HH:mm:ss"))
+		Expect(s.NewNotes()).To(Equal(filepath.Join(root, "Inbox", "Web")))
+		Expect(s.Attachments(filepath.Join(clippings, "Go.md"))).To(Equal(filepath.Join(clippings, "assets")))
+		s.AttachmentFolder = "/"
+		Expect(s.Attachments(filepath.Join(clippings, "Go.md"))).To(Equal(root))
+		s.AttachmentFolder = "Files/Web"
+		Expect(s.Attachments(filepath.Join(clippings, "Go.md"))).To(Equal(filepath.Join(root, "Files", "Web")))
+
+		Expect(os.WriteFile(filepath.Join(config, "app.json"), []byte(`{`), 0644)).To(Succeed())
+		_, err = ReadSettings(found)
+		Expect(err).To(MatchError(ContainSubstring("app.json")))
+	})
+
+	It("Should declare the property types, keeping the user's", func() {
+		b, changed, err := MergeTypes([]byte(`{"types": {"aliases": "aliases", "created": "date"}}`))
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeTrue())
+		var file map[string]map[string]string
+		Expect(json.Unmarshal(b, &file)).To(Succeed())
+		Expect(file["types"]).To(HaveKeyWithValue("aliases", "aliases"))
+		Expect(file["types"]).To(HaveKeyWithValue("created", "date"))
+		Expect(file["types"]).To(HaveKeyWithValue("reading_time", "number"))
+
+		_, changed, err = MergeTypes(b)
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeFalse())
+		_, changed, _ = MergeTypes(nil)
+		Expect(changed).To(BeTrue())
+		_, _, err = MergeTypes([]byte("{"))
+		Expect(err).NotTo(BeNil())
+	})
+})
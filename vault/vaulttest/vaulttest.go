@@ -0,0 +1,17 @@
+// Package vaulttest provides fixtures for testing the packages that build notes from the clippings of a vault.
+package vaulttest
+
+import (
+	"path/filepath"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+	"github.com/fergalsomers/pocket-obsidian/vault"
+)
+
+// Root is the vault the fixture notes are in, nothing is read from it.
+const Root = "vault"
+
+// Note returns a clipping at path (/ separated, in Root) with the metadata.
+func Note(path string, md page.ClippingMetadata) vault.Note {
+	return vault.Note{Path: filepath.Join(Root, filepath.FromSlash(path)), Clipping: &page.Clipping{Metadata: md}}
+}
@@ -0,0 +1,302 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	nurl "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fergalsomers/pocket-obsidian/canonical"
+	"github.com/fergalsomers/pocket-obsidian/page"
+)
+
+// Transport records every request and response made through next to w, as request and response records.
+// A response is recorded as received, once its body has been read or closed: only what the client reads is
+// retrieved, and a body closed before its end is recorded as far as it was read, marked WARC-Truncated.
+// Compressed responses are recorded compressed and decompressed for the client, as http.Transport does.
+type Transport struct {
+	Next http.RoundTripper
+	W    *Writer
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	decompress := false
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != http.MethodHead {
+		// ask for gzip here rather than have the transport decompress the body and drop its headers
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip")
+		decompress = true
+	}
+	dumpedRequest, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		return nil, fmt.Errorf("error recording request for %s: %w", req.URL, err)
+	}
+	resp, err := t.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body := &recordingBody{t: t, url: req.URL.String(), request: dumpedRequest, head: responseHead(resp), body: resp.Body}
+	body.chunked = len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"
+	resp.Body = body
+	if decompress && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		resp.Body = &gzipBody{body: body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
+// responseHead returns the status line and headers of resp, as received.
+func responseHead(resp *http.Response) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s\r\n", resp.Proto, resp.Status)
+	resp.Header.Write(&b)
+	if len(resp.TransferEncoding) > 0 {
+		fmt.Fprintf(&b, "Transfer-Encoding: %s\r\n", strings.Join(resp.TransferEncoding, ", "))
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// recordingBody is the body of a response, keeping what is read to record the response once the body
+// has been read or closed.
+type recordingBody struct {
+	t        *Transport
+	url      string
+	request  []byte // the dumped request
+	head     []byte // the status line and headers of the response
+	chunked  bool   // the body was received chunked, so is recorded chunked
+	body     io.ReadCloser
+	read     bytes.Buffer
+	recorded bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.read.Write(p[:n])
+	if err == io.EOF {
+		if recordErr := b.record(false); recordErr != nil {
+			return n, recordErr
+		}
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.body.Close()
+	if recordErr := b.record(true); recordErr != nil {
+		return recordErr
+	}
+	return err
+}
+
+// record writes the response and request records, the first time it is called.
+func (b *recordingBody) record(truncated bool) error {
+	if b.recorded {
+		return nil
+	}
+	b.recorded = true
+	block := bytes.NewBuffer(b.head)
+	if b.chunked {
+		w := httputil.NewChunkedWriter(block)
+		w.Write(b.read.Bytes())
+		if !truncated {
+			w.Close()
+			block.WriteString("\r\n")
+		}
+	} else {
+		block.Write(b.read.Bytes())
+	}
+	response := NewRecord(TypeResponse, b.url, contentTypeResponse, block.Bytes())
+	if truncated {
+		response.Header.Set("WARC-Truncated", "unspecified") // closed by the client before the end
+	}
+	request := NewRecord(TypeRequest, b.url, contentTypeRequest, b.request)
+	request.Header.Set("WARC-Concurrent-To", response.ID())
+	if err := b.t.W.Write(response); err != nil {
+		return fmt.Errorf("error writing WARC: %w", err)
+	}
+	if err := b.t.W.Write(request); err != nil {
+		return fmt.Errorf("error writing WARC: %w", err)
+	}
+	return nil
+}
+
+// gzipBody decompresses a gzipped body, reading nothing until it is first read.
+type gzipBody struct {
+	body *recordingBody
+	zr   *gzip.Reader
+	err  error
+}
+
+func (g *gzipBody) Read(p []byte) (int, error) {
+	if g.zr == nil && g.err == nil {
+		g.zr, g.err = gzip.NewReader(g.body)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	n, err := g.zr.Read(p)
+	if err == io.EOF {
+		// read the rest of the body, so the response is recorded complete
+		if _, err := io.Copy(io.Discard, g.body); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (g *gzipBody) Close() error {
+	return g.body.Close()
+}
+
+// Recorder retrieves pages over HTTP like page.NewContentRetriever, recording every exchange
+// (including redirects) to w.
+func Recorder(w *Writer) page.ContentRetriever {
+	return page.NewHTTPContentRetriever(&http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &Transport{Next: http.DefaultTransport, W: w},
+	})
+}
+
+// maxRedirects is the number of redirects Archive follows, as http.Client does.
+const maxRedirects = 10
+
+// Archive is a page.ContentRetriever replaying the responses recorded in a WARC file, nothing is retrieved.
+type Archive struct {
+	responses map[string]*http.Response // the last response for each canonical.Key of the URL
+	bodies    map[string][]byte         // decompressed, nil if the body wasn't recorded completely
+}
+
+// Open reads the responses recorded in a WARC file, compressed or not.
+func Open(path string) (*Archive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening WARC file: %w", err)
+	}
+	defer file.Close()
+	r, err := NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{responses: map[string]*http.Response{}, bodies: map[string][]byte{}}
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return a, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if record.Type() != TypeResponse || !strings.HasPrefix(record.Header.Get("Content-Type"), "application/http") {
+			continue
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(record.Block)), nil)
+		if err != nil {
+			return nil, fmt.Errorf("error reading response for %s in %s: %w", record.TargetURI(), path, err)
+		}
+		var body []byte
+		if record.Header.Get("WARC-Truncated") == "" {
+			if body, err = responseBody(resp); err != nil {
+				return nil, fmt.Errorf("error reading response for %s in %s: %w", record.TargetURI(), path, err)
+			}
+		}
+		key := canonical.Key(record.TargetURI())
+		a.responses[key] = resp
+		a.bodies[key] = body
+	}
+}
+
+// responseBody reads the body of a recorded response, decompressing it.
+func responseBody(resp *http.Response) ([]byte, error) {
+	var r io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+	return io.ReadAll(r)
+}
+
+// Len returns the number of URLs with a recorded response.
+func (a *Archive) Len() int {
+	return len(a.responses)
+}
+
+// Get replays the response recorded for url, following recorded redirects.
+// As for retrieving the page, non-HTML responses have no content.
+func (a *Archive) Get(url string) ([]byte, string, error) {
+	key, contentType, err := a.lookup(url)
+	if err != nil {
+		return nil, "", err
+	}
+	if !strings.HasPrefix(contentType, "text/html") {
+		return nil, contentType, nil
+	}
+	return a.body(url, key, contentType)
+}
+
+// GetResource replays the response recorded for url whatever its content type, following recorded redirects.
+// Responses other than 200 are an error.
+func (a *Archive) GetResource(url string) ([]byte, string, error) {
+	key, contentType, err := a.lookup(url)
+	if err != nil {
+		return nil, "", err
+	}
+	return a.body(url, key, contentType)
+}
+
+func (a *Archive) body(url string, key string, contentType string) ([]byte, string, error) {
+	if a.bodies[key] == nil {
+		return nil, "", fmt.Errorf("%s was not recorded completely in the WARC archive", url)
+	}
+	return a.bodies[key], contentType, nil
+}
+
+// lookup returns the key and content type of the response recorded for url, following recorded redirects.
+func (a *Archive) lookup(url string) (string, string, error) {
+	for range maxRedirects {
+		key := canonical.Key(url)
+		resp, ok := a.responses[key]
+		if !ok {
+			return "", "", fmt.Errorf("%s is not in the WARC archive", url)
+		}
+		if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+			next, err := resolve(url, location)
+			if err != nil {
+				return "", "", err
+			}
+			url = next
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", "", fmt.Errorf("error retrieving URL code: %d, %s", resp.StatusCode, url)
+		}
+		return key, resp.Header.Get("Content-Type"), nil
+	}
+	return "", "", fmt.Errorf("too many redirects replaying %s", url)
+}
+
+func resolve(base string, location string) (string, error) {
+	u, err := nurl.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("bad URL %s: %w", base, err)
+	}
+	ref, err := u.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("bad redirect from %s to %s: %w", base, location, err)
+	}
+	return ref.String(), nil
+}
@@ -0,0 +1,200 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record types used by pocket-obsidian.
+const (
+	TypeInfo     = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+)
+
+// Content types of the record blocks.
+const (
+	contentTypeFields   = "application/warc-fields"
+	contentTypeRequest  = "application/http;msgtype=request"
+	contentTypeResponse = "application/http;msgtype=response"
+)
+
+const version = "WARC/1.1"
+
+// Record is a WARC record: its named header fields and the block of content.
+type Record struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+}
+
+// NewRecord returns a record of the given type with a new ID, dated now.
+func NewRecord(recordType string, targetURI string, contentType string, block []byte) *Record {
+	h := textproto.MIMEHeader{}
+	h.Set("WARC-Type", recordType)
+	h.Set("WARC-Record-ID", newID())
+	h.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	if targetURI != "" {
+		h.Set("WARC-Target-URI", targetURI)
+	}
+	h.Set("Content-Type", contentType)
+	return &Record{Header: h, Block: block}
+}
+
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+func (r *Record) TargetURI() string {
+	return r.Header.Get("WARC-Target-URI")
+}
+
+func (r *Record) ID() string {
+	return r.Header.Get("WARC-Record-ID")
+}
+
+// newID returns a new record ID, a random UUID.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// blockDigest is the WARC-Block-Digest of a block, its base 32 SHA-1.
+func blockDigest(block []byte) string {
+	sum := sha1.Sum(block)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// Writer writes WARC records, it is safe for concurrent use.
+type Writer struct {
+	mu       sync.Mutex
+	w        io.Writer
+	compress bool
+}
+
+// NewWriter writes records to w, each compressed as a separate gzip member if compress, as .warc.gz files are.
+// A warcinfo record describing the file is written first.
+func NewWriter(w io.Writer, compress bool) (*Writer, error) {
+	ww := &Writer{w: w, compress: compress}
+	info := "software: pocket-obsidian\r\nformat: WARC File Format 1.1\r\n"
+	if err := ww.Write(NewRecord(TypeInfo, "", contentTypeFields, []byte(info))); err != nil {
+		return nil, err
+	}
+	return ww, nil
+}
+
+// Write writes the record, filling in its Content-Length and WARC-Block-Digest.
+func (w *Writer) Write(r *Record) error {
+	r.Header.Set("Content-Length", strconv.Itoa(len(r.Block)))
+	r.Header.Set("WARC-Block-Digest", blockDigest(r.Block))
+
+	var b bytes.Buffer
+	b.WriteString(version + "\r\n")
+	// WARC-Type first, as readers expect, then the rest in a stable order
+	fmt.Fprintf(&b, "WARC-Type: %s\r\n", r.Type())
+	for _, name := range []string{"WARC-Record-ID", "WARC-Date", "WARC-Target-URI", "WARC-Concurrent-To", "WARC-Truncated", "WARC-Block-Digest", "Content-Type", "Content-Length"} {
+		if v := r.Header.Get(name); v != "" {
+			fmt.Fprintf(&b, "%s: %s\r\n", name, v)
+		}
+	}
+	b.WriteString("\r\n")
+	b.Write(r.Block)
+	b.WriteString("\r\n\r\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.compress {
+		_, err := w.w.Write(b.Bytes())
+		return err
+	}
+	gz := gzip.NewWriter(w.w)
+	if _, err := gz.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// File is a Writer to a file, which must be closed.
+type File struct {
+	*Writer
+	file *os.File
+}
+
+// Create creates a WARC file, compressed if path ends in .gz.
+func Create(path string) (*File, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating WARC file: %w", err)
+	}
+	w, err := NewWriter(file, strings.HasSuffix(strings.ToLower(path), ".gz"))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error writing WARC file %s: %w", path, err)
+	}
+	return &File{Writer: w, file: file}, nil
+}
+
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// Reader reads the records of a WARC file, compressed or not.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader reads records from r, decompressing it if it is gzipped.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing WARC: %w", err)
+		}
+		br = bufio.NewReader(gz)
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF after the last.
+func (r *Reader) Next() (*Record, error) {
+	tp := textproto.NewReader(r.r)
+	line := ""
+	for line == "" {
+		var err error
+		if line, err = tp.ReadLine(); err != nil {
+			return nil, err // io.EOF at the end of the file
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("expected a WARC record, found %q", line)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("error reading WARC record header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad WARC record Content-Length %q", header.Get("Content-Length"))
+	}
+	block := make([]byte, length)
+	if _, err := io.ReadFull(r.r, block); err != nil {
+		return nil, fmt.Errorf("error reading WARC record: %w", err)
+	}
+	return &Record{Header: header, Block: block}, nil
+}
@@ -0,0 +1,192 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fergalsomers/pocket-obsidian/page"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWARC(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "warc suite")
+}
+
+const article = `<html><head><title>Recorded Article</title></head><body><article><h1>Recorded Article</h1><p>This page was recorded in a WARC file and replayed from it.</p></article></body></html>`
+
+var _ = Describe("WARCTest", func() {
+
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, article)
+		})
+		mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+		})
+		mux.HandleFunc("/report.pdf", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/pdf")
+			io.WriteString(w, "%PDF-1.4")
+		})
+		mux.HandleFunc("/compressed", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			io.WriteString(gz, article)
+			gz.Close()
+			w.(http.Flusher).Flush() // sent chunked
+		})
+		mux.HandleFunc("/video.mp4", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write(make([]byte, 8<<20))
+		})
+		server = httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+	})
+
+	for _, name := range []string{"run.warc.gz", "run.warc"} {
+		It("Should record and replay a run in "+name, func() {
+			path := filepath.Join(GinkgoT().TempDir(), name)
+			f, err := Create(path)
+			Expect(err).To(BeNil())
+			recorder := Recorder(f.Writer)
+			content, contentType, err := recorder.Get(server.URL + "/moved")
+			Expect(err).To(BeNil())
+			Expect(contentType).To(HavePrefix("text/html"))
+			Expect(string(content)).To(Equal(article))
+			_, _, err = recorder.Get(server.URL + "/report.pdf")
+			Expect(err).To(BeNil())
+			_, _, err = recorder.Get(server.URL + "/missing")
+			Expect(err).NotTo(BeNil())
+			Expect(f.Close()).To(Succeed())
+
+			// warcinfo, then a response and request for each of the 4 exchanges
+			file, err := os.Open(path)
+			Expect(err).To(BeNil())
+			defer file.Close()
+			r, err := NewReader(file)
+			Expect(err).To(BeNil())
+			types := []string{}
+			for {
+				record, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).To(BeNil())
+				types = append(types, record.Type())
+				if record.Type() == TypeRequest {
+					Expect(record.Header.Get("WARC-Concurrent-To")).To(HavePrefix("<urn:uuid:"))
+				}
+			}
+			Expect(types).To(Equal([]string{TypeInfo,
+				TypeResponse, TypeRequest, TypeResponse, TypeRequest, TypeResponse, TypeRequest, TypeResponse, TypeRequest}))
+
+			server.Close() // replaying retrieves nothing
+			archive, err := Open(path)
+			Expect(err).To(BeNil())
+			Expect(archive.Len()).To(Equal(4))
+			content, contentType, err = archive.Get(server.URL + "/moved")
+			Expect(err).To(BeNil())
+			Expect(contentType).To(HavePrefix("text/html"))
+			Expect(string(content)).To(Equal(article))
+			content, contentType, err = archive.Get(server.URL + "/report.pdf")
+			Expect(err).To(BeNil())
+			Expect(content).To(BeNil())
+			Expect(contentType).To(Equal("application/pdf"))
+			_, _, err = archive.Get(server.URL + "/missing")
+			Expect(err).To(MatchError(ContainSubstring("404")))
+			_, _, err = archive.Get(server.URL + "/never-retrieved")
+			Expect(err).To(MatchError(ContainSubstring("not in the WARC archive")))
+
+			c, err := page.PageToClipping(archive, &page.Page{Title: "x", Url: server.URL + "/article"})
+			Expect(err).To(BeNil())
+			Expect(c.Metadata.Title).To(Equal("Recorded Article"))
+		})
+	}
+
+	It("Should record responses as received, without retrieving more than is read", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "run.warc")
+		f, err := Create(path)
+		Expect(err).To(BeNil())
+		recorder := Recorder(f.Writer)
+		content, _, err := recorder.Get(server.URL + "/compressed")
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(Equal(article), "decompressed for the client")
+		content, contentType, err := recorder.Get(server.URL + "/video.mp4")
+		Expect(err).To(BeNil())
+		Expect(content).To(BeNil())
+		Expect(contentType).To(Equal("video/mp4"))
+		Expect(f.Close()).To(Succeed())
+
+		info, err := os.Stat(path)
+		Expect(err).To(BeNil())
+		Expect(info.Size()).To(BeNumerically("<", 1<<20), "the video isn't downloaded")
+		file, err := os.Open(path)
+		Expect(err).To(BeNil())
+		defer file.Close()
+		r, err := NewReader(file)
+		Expect(err).To(BeNil())
+		responses := map[string]*Record{}
+		for {
+			record, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).To(BeNil())
+			if record.Type() == TypeResponse {
+				responses[record.TargetURI()] = record
+			}
+		}
+		compressed := string(responses[server.URL+"/compressed"].Block)
+		Expect(compressed).To(ContainSubstring("Content-Encoding: gzip\r\n"))
+		Expect(compressed).To(ContainSubstring("Transfer-Encoding: chunked\r\n"))
+		Expect(compressed).NotTo(ContainSubstring("Recorded Article"), "the body is recorded compressed")
+		Expect(responses[server.URL+"/compressed"].Header.Get("WARC-Truncated")).To(BeEmpty())
+		Expect(responses[server.URL+"/video.mp4"].Header.Get("WARC-Truncated")).NotTo(BeEmpty())
+
+		archive, err := Open(path)
+		Expect(err).To(BeNil())
+		content, _, err = archive.Get(server.URL + "/compressed")
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(Equal(article))
+		content, contentType, err = archive.Get(server.URL + "/video.mp4")
+		Expect(err).To(BeNil())
+		Expect(content).To(BeNil())
+		Expect(contentType).To(Equal("video/mp4"))
+		_, _, err = archive.GetResource(server.URL + "/video.mp4")
+		Expect(err).To(MatchError(ContainSubstring("not recorded completely")))
+	})
+
+	It("Should write records another reader can split", func() {
+		var b bytes.Buffer
+		w, err := NewWriter(&b, false)
+		Expect(err).To(BeNil())
+		Expect(w.Write(NewRecord("resource", "https://example.com/", "text/plain", []byte("hello\r\n\r\nworld")))).To(Succeed())
+		Expect(b.String()).To(ContainSubstring("WARC/1.1\r\nWARC-Type: resource\r\n"))
+		Expect(b.String()).To(ContainSubstring("Content-Length: 14\r\n"))
+
+		r, err := NewReader(&b)
+		Expect(err).To(BeNil())
+		_, err = r.Next()
+		Expect(err).To(BeNil())
+		record, err := r.Next()
+		Expect(err).To(BeNil())
+		Expect(record.TargetURI()).To(Equal("https://example.com/"))
+		Expect(string(record.Block)).To(Equal("hello\r\n\r\nworld"))
+		Expect(record.Header.Get("WARC-Block-Digest")).To(HavePrefix("sha1:"))
+		_, err = r.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+})
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/fergalsomers/pocket-obsidian/watch"
+)
+
+// watchInbox clips each input dropped into the --watch folder until interrupted, returning the exit status.
+// Records which fail are written to a CSV named after the input in the inbox's failed folder.
+func watchInbox() int {
+	in := watch.New(watchDir, func(input string) error {
+		name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+		failedCSV = filepath.Join(watchDir, watch.FailedFolder, name+".failed.csv")
+		if err := os.MkdirAll(filepath.Dir(failedCSV), 0755); err != nil {
+			return err
+		}
+		return convert([]string{input})
+	})
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("Watching %s for inputs to clip to %s", watchDir, outputDir)
+	if err := in.Run(ctx, watchPoll); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,178 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Default folders of the inbox the processed inputs are moved to.
+const (
+	DoneFolder   = "done"
+	FailedFolder = "failed"
+)
+
+// Inbox is a folder watched for input files, each processed once it has been completely written
+// and then moved to the done folder, or the failed folder if it couldn't be processed.
+type Inbox struct {
+	Dir     string
+	Done    string        // folder processed inputs are moved to
+	Failed  string        // folder inputs which couldn't be processed are moved to
+	Settle  time.Duration // how long an input must be unchanged before it's processed, so partly copied files aren't
+	Poll    time.Duration // how often the inbox is scanned when not notified of changes
+	Process func(path string) error
+
+	seen  map[string]file
+	stuck map[string]file // inputs processed but not moved out of the inbox, skipped until they change
+}
+
+// file is the size and modification time an input was last seen with.
+type file struct {
+	size    int64
+	modTime time.Time
+}
+
+// New returns the inbox dir, moving inputs to its done and failed folders.
+func New(dir string, process func(path string) error) *Inbox {
+	return &Inbox{
+		Dir:     dir,
+		Done:    filepath.Join(dir, DoneFolder),
+		Failed:  filepath.Join(dir, FailedFolder),
+		Settle:  2 * time.Second,
+		Poll:    5 * time.Second,
+		Process: process,
+	}
+}
+
+// Scan processes the inputs which are ready: unchanged since the last scan and for at least Settle.
+// Reports whether there are inputs which aren't ready yet, which need another scan.
+func (in *Inbox) Scan(now time.Time) (bool, error) {
+	entries, err := os.ReadDir(in.Dir)
+	if err != nil {
+		return false, fmt.Errorf("error reading inbox %s: %w", in.Dir, err)
+	}
+	if in.seen == nil {
+		in.seen = map[string]file{}
+	}
+	pending := false
+	current := map[string]file{}
+	stuck := map[string]file{}
+	for _, e := range entries {
+		// folders, such as done and failed, and hidden or temporary files aren't inputs
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || strings.HasPrefix(e.Name(), "~") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since
+		}
+		f := file{size: info.Size(), modTime: info.ModTime()}
+		if last, ok := in.stuck[e.Name()]; ok && last == f {
+			stuck[e.Name()] = f
+			continue
+		}
+		if last, ok := in.seen[e.Name()]; !ok || last != f || now.Sub(f.modTime) < in.Settle {
+			current[e.Name()] = f
+			pending = true
+			continue
+		}
+		if !in.process(filepath.Join(in.Dir, e.Name())) {
+			stuck[e.Name()] = f
+		}
+	}
+	in.seen = current
+	in.stuck = stuck
+	return pending, nil
+}
+
+// process processes the input at path, moving it to the done or failed folder.
+// Reports whether it was moved out of the inbox.
+func (in *Inbox) process(path string) bool {
+	log.Printf("Processing %s", path)
+	folder := in.Done
+	if err := in.Process(path); err != nil {
+		log.Printf("Unable to process %s: %v", path, err)
+		folder = in.Failed
+	}
+	moved, err := Move(path, folder)
+	if err != nil {
+		log.Printf("Unable to move %s out of the inbox, it won't be processed again unless it changes: %v", path, err)
+		return false
+	}
+	log.Printf("Moved %s to %s", path, moved)
+	return true
+}
+
+// Move moves the file at path into folder, creating it if needed. If the folder already has a file
+// of that name, a number is added to the name. Returns the new path.
+func Move(path string, folder string) (string, error) {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return "", fmt.Errorf("error creating %s: %w", folder, err)
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	target := filepath.Join(folder, base+ext)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			break
+		}
+		target = filepath.Join(folder, fmt.Sprintf("%s %d%s", base, i, ext))
+	}
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// Run watches the inbox until ctx is done, processing the inputs already in it and then each new one.
+// It is notified of changes where the filesystem supports it, otherwise (or if poll is set) it scans every Poll.
+func (in *Inbox) Run(ctx context.Context, poll bool) error {
+	var events chan fsnotify.Event
+	var errs chan error
+	if !poll {
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			if err = watcher.Add(in.Dir); err != nil {
+				watcher.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("Unable to be notified of changes to %s, scanning it every %s instead: %v", in.Dir, in.Poll, err)
+		} else {
+			defer watcher.Close()
+			events, errs = watcher.Events, watcher.Errors
+		}
+	}
+
+	// a nil channel never receives, so without notifications only the timer fires
+	interval := in.Poll
+	if events != nil {
+		interval = in.Settle
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			log.Printf("Error watching %s: %v", in.Dir, err)
+		case <-events:
+			timer.Reset(in.Settle)
+		case <-timer.C:
+			pending, err := in.Scan(time.Now())
+			if err != nil {
+				return err
+			}
+			if pending || events == nil {
+				timer.Reset(interval)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWatch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "watch suite")
+}
+
+// processed records the inputs processed, failing those whose name contains "bad".
+type processed struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (p *processed) process(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.names = append(p.names, filepath.Base(path))
+	if strings.Contains(path, "bad") {
+		return errors.New("not an export")
+	}
+	return nil
+}
+
+func (p *processed) list() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.names...)
+}
+
+func write(path string, content string, modTime time.Time) {
+	Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+}
+
+var _ = Describe("WatchTest", func() {
+
+	var dir string
+	var p *processed
+	var in *Inbox
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		p = &processed{}
+		in = New(dir, p.process)
+	})
+
+	It("Should process inputs once they have settled, moving them to done or failed", func() {
+		now := time.Now()
+		old := now.Add(-time.Minute)
+		write(filepath.Join(dir, "links.txt"), "https://example.com/\n", old)
+		write(filepath.Join(dir, "bad.csv"), "nonsense", old)
+		write(filepath.Join(dir, "copying.csv"), "title,url", now)
+		write(filepath.Join(dir, ".DS_Store"), "", old)
+		Expect(os.Mkdir(filepath.Join(dir, "export"), 0755)).To(Succeed())
+
+		pending, err := in.Scan(now)
+		Expect(err).To(BeNil())
+		Expect(pending).To(BeTrue())
+		Expect(p.list()).To(BeEmpty(), "not seen unchanged yet")
+
+		pending, err = in.Scan(now)
+		Expect(err).To(BeNil())
+		Expect(pending).To(BeTrue(), "copying.csv has just changed")
+		Expect(p.list()).To(Equal([]string{"bad.csv", "links.txt"}))
+		Expect(filepath.Join(dir, DoneFolder, "links.txt")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, FailedFolder, "bad.csv")).To(BeAnExistingFile())
+
+		write(filepath.Join(dir, "copying.csv"), "title,url\nx,https://example.com/", now)
+		_, err = in.Scan(now.Add(time.Minute))
+		Expect(err).To(BeNil())
+		Expect(p.list()).To(HaveLen(2), "changed since the last scan")
+		pending, err = in.Scan(now.Add(time.Minute))
+		Expect(err).To(BeNil())
+		Expect(pending).To(BeFalse())
+		Expect(p.list()).To(Equal([]string{"bad.csv", "links.txt", "copying.csv"}))
+		Expect(filepath.Join(dir, ".DS_Store")).To(BeAnExistingFile())
+	})
+
+	It("Should not process inputs again when they can't be moved", func() {
+		blocked := filepath.Join(GinkgoT().TempDir(), "file")
+		write(blocked, "", time.Now())
+		in.Done = filepath.Join(blocked, DoneFolder) // can't be created
+		old := time.Now().Add(-time.Minute)
+		write(filepath.Join(dir, "links.txt"), "https://example.com/\n", old)
+
+		for i := 0; i < 4; i++ {
+			_, err := in.Scan(time.Now())
+			Expect(err).To(BeNil())
+		}
+		Expect(p.list()).To(Equal([]string{"links.txt"}))
+		Expect(filepath.Join(dir, "links.txt")).To(BeAnExistingFile())
+
+		write(filepath.Join(dir, "links.txt"), "https://example.com/\nhttps://example.org/\n", old)
+		for i := 0; i < 2; i++ {
+			_, err := in.Scan(time.Now())
+			Expect(err).To(BeNil())
+		}
+		Expect(p.list()).To(Equal([]string{"links.txt", "links.txt"}), "changed since")
+	})
+
+	It("Should not overwrite inputs already moved", func() {
+		done := filepath.Join(dir, DoneFolder)
+		Expect(os.Mkdir(done, 0755)).To(Succeed())
+		write(filepath.Join(done, "links.txt"), "first", time.Now())
+		write(filepath.Join(dir, "links.txt"), "second", time.Now())
+		moved, err := Move(filepath.Join(dir, "links.txt"), done)
+		Expect(err).To(BeNil())
+		Expect(moved).To(Equal(filepath.Join(done, "links 2.txt")))
+		b, _ := os.ReadFile(filepath.Join(done, "links.txt"))
+		Expect(string(b)).To(Equal("first"))
+	})
+
+	for _, poll := range []bool{false, true} {
+		It(fmt.Sprintf("Should watch for new inputs (polling %v)", poll), func() {
+			in.Settle = 10 * time.Millisecond
+			in.Poll = 10 * time.Millisecond
+			write(filepath.Join(dir, "before.txt"), "https://example.com/", time.Now().Add(-time.Minute))
+			ctx, cancel := context.WithCancel(context.Background())
+			finished := make(chan error)
+			go func() { finished <- in.Run(ctx, poll) }()
+
+			Eventually(p.list).Should(Equal([]string{"before.txt"}))
+			write(filepath.Join(dir, "after.txt"), "https://example.com/", time.Now())
+			Eventually(p.list).Should(Equal([]string{"before.txt", "after.txt"}))
+			Expect(filepath.Join(dir, DoneFolder, "after.txt")).To(BeAnExistingFile())
+			cancel()
+			Expect(<-finished).To(Succeed())
+		})
+	}
+})